@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+
+	"flashcat.cloud/categraf/aggregators"
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cfg"
+	"flashcat.cloud/categraf/processors"
+)
+
+// nopOperation ignores the inputs registered by providers, the inputs are loaded by hand
+type nopOperation struct{}
+
+func (nopOperation) RegisterInput(string, []cfg.ConfigWithFormat) {}
+func (nopOperation) DeregisterInput(string, string)               {}
+
+// CheckConfig loads config.toml and every input through the providers the way the agent
+// does, without starting anything. It returns the problems found.
+func CheckConfig() (problems []string) {
+	c := config.Config
+	unknown, err := cfg.UnknownKeysOfDir(c.ConfigDir, func() interface{} { return &config.ConfigType{} })
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", c.ConfigDir, err))
+	}
+	for _, f := range sortedKeys(unknown) {
+		for _, k := range unknown[f] {
+			problems = append(problems, fmt.Sprintf("%s: unknown key %s", f, k))
+		}
+	}
+
+	if err := processors.Init(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := aggregators.Check(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	providers, err := newNopProviders(c)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	filters := parseFilter(c.InputFilters)
+	for _, p := range providers {
+		problems = append(problems, checkProvider(p, filters)...)
+	}
+	return problems
+}
+
+// newNopProviders is inputs.NewProvider without registering, it does not panic on unknown providers
+func newNopProviders(c *config.ConfigType) (providers []inputs.Provider, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return inputs.NewProvider(c, nopOperation{})
+}
+
+func checkProvider(p inputs.Provider, filters map[string]struct{}) (problems []string) {
+	if _, err := p.LoadConfig(); err != nil {
+		problems = append(problems, fmt.Sprintf("provider %s: failed to load configs: %v", p.Name(), err))
+	}
+	names, err := p.GetInputs()
+	if err != nil {
+		return append(problems, fmt.Sprintf("provider %s: failed to list inputs: %v", p.Name(), err))
+	}
+	sort.Strings(names)
+
+	for _, inputKey := range names {
+		if _, has := filters[inputKey]; len(filters) > 0 && !has {
+			continue
+		}
+		name := inputs.FormatInputName(p.Name(), inputKey)
+		report := func(format string, a ...interface{}) {
+			problems = append(problems, "input "+name+": "+fmt.Sprintf(format, a...))
+		}
+
+		creator, has := inputs.InputCreators[inputKey]
+		if !has {
+			report("not supported")
+			continue
+		}
+		configs, err := p.GetInputConfig(inputKey)
+		if err != nil {
+			report("failed to get configuration: %v", err)
+			continue
+		}
+
+		valid := true
+		for i, c := range configs {
+			source := c.Source
+			if source == "" {
+				source = fmt.Sprintf("config #%d", i)
+			}
+			unknown, err := cfg.UnknownKeys(c, creator())
+			if err != nil {
+				report("%s: %v", source, err)
+				valid = false
+			}
+			for _, k := range unknown {
+				report("%s: unknown key %s", source, k)
+			}
+		}
+		if !valid {
+			continue
+		}
+
+		loaded, err := p.LoadInputConfig(configs, creator())
+		if err != nil {
+			report("failed to load configuration: %v", err)
+			continue
+		}
+		for _, sum := range sortedKeys(loaded) {
+			input := loaded[sum]
+			if err := input.InitInternalConfig(); err != nil {
+				report("%v", err)
+				continue
+			}
+			for j, ins := range inputs.MayGetInstances(input) {
+				if err := ins.InitInternalConfig(); err != nil {
+					report("instance #%d: %v", j, err)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func writeConf(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, "config.toml", `
+[global]
+interval = 15
+intervall = 10
+
+[writer_opt]
+batch = 1000
+`)
+	writeConf(t, dir, "input.cpu/cpu.toml", `
+collect_per_cpu = true
+colect_per_cpu = true
+`)
+	writeConf(t, dir, "input.mem/mem.toml", `
+collect_platform_fields = "yes"
+`)
+	writeConf(t, dir, "input.net/net.toml", `
+[[relabel_configs]]
+source_labels = ["interface"]
+regex = "(eth"
+`)
+	writeConf(t, dir, "input.diskio/diskio.toml", `
+devices = ["sda"]
+`)
+	require.NoError(t, config.InitConfig(dir, 0, false, false, 0, ""))
+
+	problems := CheckConfig()
+	require.Len(t, problems, 4, "%v", problems)
+	require.Contains(t, problems[0], "config.toml: unknown key global.intervall")
+	require.Contains(t, problems[1], "input local.cpu: "+filepath.Join(dir, "input.cpu/cpu.toml")+": unknown key colect_per_cpu")
+	require.Contains(t, problems[2], "input local.mem: ")
+	require.Contains(t, problems[3], "input local.net: relabel_configs regex:(eth compile error")
+}
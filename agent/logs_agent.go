@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"flashcat.cloud/categraf/logs/auditor"
@@ -57,6 +58,9 @@ type LogsAgent struct {
 	pipelineProvider          pipeline.Provider
 	inputs                    []restart.Restartable
 	diagnosticMessageReceiver *diagnostic.BufferedMessageReceiver
+
+	// read by the status api
+	isRunning int32
 }
 
 // NewLogsAgent returns a new Logs LogsAgent
@@ -139,6 +143,8 @@ func NewLogsAgent() AgentModule {
 
 func (la *LogsAgent) Start() error {
 	la.startInner()
+	status.Init(&la.isRunning, la.endpoints, la.sources, nil)
+	atomic.StoreInt32(&la.isRunning, 1)
 	if coreconfig.EnableCollectContainer() {
 		// collect container all
 		if util.Debug() {
@@ -188,6 +194,8 @@ func (a *LogsAgent) Flush(ctx context.Context) {
 // Stop stops all the elements of the data pipeline
 // in the right order to prevent data loss
 func (a *LogsAgent) Stop() error {
+	atomic.StoreInt32(&a.isRunning, 0)
+	status.Clear()
 	inputs := restart.NewParallelStopper()
 	for _, input := range a.inputs {
 		inputs.Add(input)
@@ -1,15 +1,14 @@
 package agent
 
 import (
-	"errors"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/inputs"
 	"flashcat.cloud/categraf/pkg/cfg"
-	"flashcat.cloud/categraf/types"
 
 	// auto registry
 	_ "flashcat.cloud/categraf/inputs/aliyun"
@@ -88,6 +87,7 @@ import (
 	_ "flashcat.cloud/categraf/inputs/sockstat"
 	_ "flashcat.cloud/categraf/inputs/spark_streaming"
 	_ "flashcat.cloud/categraf/inputs/sqlserver"
+	_ "flashcat.cloud/categraf/inputs/statsd"
 	_ "flashcat.cloud/categraf/inputs/supervisor"
 	_ "flashcat.cloud/categraf/inputs/switch_legacy"
 	_ "flashcat.cloud/categraf/inputs/system"
@@ -106,6 +106,9 @@ type MetricsAgent struct {
 	InputFilters   map[string]struct{}
 	InputReaders   *Readers
 	InputProviders []inputs.Provider
+
+	// serializes registering and deregistering inputs, by the reloaders of providers and the reload api
+	lock sync.Mutex
 }
 
 type Readers struct {
@@ -120,13 +123,19 @@ func NewReaders() *Readers {
 	}
 }
 
+// Add records reader, the reader of the same name and checksum it replaces is stopped
 func (r *Readers) Add(name string, sum string, reader *InputReader) {
 	r.lock.Lock()
-	defer r.lock.Unlock()
 	if _, ok := r.record[name]; !ok {
 		r.record[name] = make(map[string]*InputReader)
 	}
+	old := r.record[name][sum]
 	r.record[name][sum] = reader
+	r.lock.Unlock()
+
+	if old != nil && old != reader {
+		old.Stop()
+	}
 }
 
 func (r *Readers) Del(name string, sum string) {
@@ -154,6 +163,26 @@ func (r *Readers) Iter() map[string]map[string]*InputReader {
 	return r.record
 }
 
+// List returns all readers, sorted by name and checksum
+func (r *Readers) List() []*InputReader {
+	r.lock.RLock()
+	ret := make([]*InputReader, 0, len(r.record))
+	for _, m := range r.record {
+		for _, reader := range m {
+			ret = append(ret, reader)
+		}
+	}
+	r.lock.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].inputName != ret[j].inputName {
+			return ret[i].inputName < ret[j].inputName
+		}
+		return ret[i].sum < ret[j].sum
+	})
+	return ret
+}
+
 func NewMetricsAgent() AgentModule {
 	c := config.Config
 	agent := &MetricsAgent{
@@ -167,6 +196,7 @@ func NewMetricsAgent() AgentModule {
 		return nil
 	}
 	agent.InputProviders = provider
+	metricsAgent.Store(agent)
 	return agent
 }
 
@@ -227,6 +257,8 @@ func (ma *MetricsAgent) Stop() error {
 	for idx := range ma.InputProviders {
 		ma.InputProviders[idx].StopReloader()
 	}
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
 	for name := range ma.InputReaders.Iter() {
 		inputs, _ := ma.InputReaders.GetInput(name)
 		for sum, r := range inputs {
@@ -238,6 +270,13 @@ func (ma *MetricsAgent) Stop() error {
 }
 
 func (ma *MetricsAgent) RegisterInput(name string, configs []cfg.ConfigWithFormat) {
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
+	ma.registerInput(name, configs)
+}
+
+// registerInput is RegisterInput, the lock is held by the caller
+func (ma *MetricsAgent) registerInput(name string, configs []cfg.ConfigWithFormat) {
 	typ, inputKey := inputs.ParseInputName(name)
 	if !ma.FilterPass(inputKey) {
 		return
@@ -277,53 +316,26 @@ func (ma *MetricsAgent) inputGo(name string, sum string, input inputs.Input) {
 		return
 	}
 
-	if err = inputs.MayInit(input); err != nil {
-		if !errors.Is(err, types.ErrInstancesEmpty) {
-			log.Println("E! failed to init input:", name, "error:", err)
-		} else {
-			if config.Config.DebugMode {
-				_, inputKey := inputs.ParseInputName(name)
-				log.Println("W! no instances for input: ", inputKey)
-			}
-		}
+	reader := newInputReader(name, sum, input)
+	// the reader replaced is stopped before the init states of this one are recorded
+	ma.InputReaders.Add(name, sum, reader)
+	if !reader.initInput() {
+		ma.InputReaders.Del(name, sum)
+		inputs.DelInitStates(name, sum)
 		return
 	}
-
-	instances := inputs.MayGetInstances(input)
-	if instances != nil {
-		empty := true
-		for i := 0; i < len(instances); i++ {
-			if err := instances[i].InitInternalConfig(); err != nil {
-				log.Println("E! failed to init input:", name, "error:", err)
-				continue
-			}
-
-			if err := inputs.MayInit(instances[i]); err != nil {
-				if !errors.Is(err, types.ErrInstancesEmpty) {
-					log.Println("E! failed to init input:", name, "error:", err)
-				}
-				continue
-			}
-			empty = false
-			instances[i].SetInitialized()
-		}
-
-		if empty {
-			if config.Config.DebugMode {
-				_, inputKey := inputs.ParseInputName(name)
-				log.Printf("W! no instances for input:%s", inputKey)
-			}
-			return
-		}
-	}
-
-	reader := newInputReader(name, input)
 	go reader.startInput()
-	ma.InputReaders.Add(name, sum, reader)
 	log.Println("I! input:", name, "started")
 }
 
 func (ma *MetricsAgent) DeregisterInput(name string, sum string) {
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
+	ma.deregisterInput(name, sum)
+}
+
+// deregisterInput is DeregisterInput, the lock is held by the caller
+func (ma *MetricsAgent) deregisterInput(name string, sum string) {
 	if inputs, has := ma.InputReaders.GetInput(name); has {
 		for isum, input := range inputs {
 			if len(sum) == 0 || sum == isum {
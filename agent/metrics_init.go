@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/backoff"
+	"flashcat.cloud/categraf/types"
+)
+
+// wait 1s to 300s between two init attempts of a failed instance
+var initBackoff = backoff.NewPolicy(2, 1, 300, 1, false)
+
+type pendingInstance struct {
+	index    int
+	instance inputs.Instance
+}
+
+// initInput inits the input and its instances. Those failed are retried in background with
+// backoff, and gathered once initialized. It returns false if there is nothing to gather.
+func (r *InputReader) initInput() bool {
+	err := inputs.MayInit(r.input)
+	if errors.Is(err, types.ErrInstancesEmpty) {
+		if config.Config.DebugMode {
+			_, inputKey := inputs.ParseInputName(r.inputName)
+			log.Println("W! no instances for input: ", inputKey)
+		}
+		return false
+	}
+	if _, ok := r.setInitState(r.input, "", err); !ok {
+		return false
+	}
+	if err != nil {
+		log.Println("E! failed to init input:", r.inputName, "error:", err)
+		// service inputs start right after init, they are not retried
+		if _, ok := r.input.(inputs.ServiceInput); ok {
+			return false
+		}
+		go r.reinit(false, nil)
+		return true
+	}
+	r.inputReady = true
+
+	instances := inputs.MayGetInstances(r.input)
+	if instances == nil {
+		return true
+	}
+	empty := true
+	var pending []pendingInstance
+	for _, p := range r.pendingInstances(instances) {
+		ok, retry := r.initInstance(p)
+		if ok {
+			p.instance.SetInitialized()
+			empty = false
+		} else if retry {
+			pending = append(pending, p)
+			empty = false
+		}
+	}
+	if empty {
+		if config.Config.DebugMode {
+			_, inputKey := inputs.ParseInputName(r.inputName)
+			log.Printf("W! no instances for input:%s", inputKey)
+		}
+		return false
+	}
+	if len(pending) > 0 {
+		go r.reinit(true, pending)
+	}
+	return true
+}
+
+// pendingInstances returns the instances whose internal config is valid
+func (r *InputReader) pendingInstances(instances []inputs.Instance) []pendingInstance {
+	ret := make([]pendingInstance, 0, len(instances))
+	for i := range instances {
+		if err := instances[i].InitInternalConfig(); err != nil {
+			log.Println("E! failed to init input:", r.inputName, "error:", err)
+			continue
+		}
+		ret = append(ret, pendingInstance{index: i, instance: instances[i]})
+	}
+	return ret
+}
+
+// setInitState records the result of initializing t, the input or one of its instances. It
+// returns false if the reader has stopped meanwhile, t is dropped then if it was initialized,
+// and the state is not recorded so that Stop removing them wins.
+func (r *InputReader) setInitState(t interface{}, instance string, err error) (inputs.InitState, bool) {
+	r.initStateLock.Lock()
+	if r.stopped() {
+		r.initStateLock.Unlock()
+		if err == nil {
+			inputs.MayDrop(t)
+		}
+		return inputs.InitState{}, false
+	}
+	st := inputs.SetInitState(r.inputName, r.sum, instance, err)
+	r.initStateLock.Unlock()
+	return st, true
+}
+
+// initInstance returns whether the instance is initialized, or else whether it's worth a retry
+func (r *InputReader) initInstance(p pendingInstance) (bool, bool) {
+	err := inputs.MayInit(p.instance)
+	if errors.Is(err, types.ErrInstancesEmpty) {
+		return false, false
+	}
+	st, ok := r.setInitState(p.instance, inputs.InstanceIndex(p.index), err)
+	if !ok {
+		return false, false
+	}
+	if err != nil {
+		log.Printf("E! failed to init input: %s instance #%d, attempts: %d, error: %v", r.inputName, p.index, st.Attempts, err)
+		return false, true
+	}
+	if st.Attempts > 1 {
+		log.Printf("I! input: %s instance #%d initialized after %d attempts", r.inputName, p.index, st.Attempts)
+	}
+	return true, false
+}
+
+// reinit retries the input and the pending instances until all of them are initialized or
+// the reader stops. The gather goroutine is told by inits.
+func (r *InputReader) reinit(inputReady bool, pending []pendingInstance) {
+	policy := initBackoff
+	numErrors := 0
+	for {
+		numErrors = policy.IncError(numErrors)
+		select {
+		case <-r.done:
+			return
+		case <-time.After(policy.GetBackoffDuration(numErrors)):
+		}
+
+		if !inputReady {
+			err := inputs.MayInit(r.input)
+			st, ok := r.setInitState(r.input, "", err)
+			if !ok {
+				return
+			}
+			if err != nil {
+				log.Printf("E! failed to init input: %s, attempts: %d, error: %v", r.inputName, st.Attempts, err)
+				continue
+			}
+			log.Printf("I! input: %s initialized after %d attempts", r.inputName, st.Attempts)
+			inputReady = true
+			pending = r.pendingInstances(inputs.MayGetInstances(r.input))
+			if !r.notify(func() { r.inputReady = true }) {
+				return
+			}
+		}
+
+		remaining := pending[:0]
+		for _, p := range pending {
+			ok, retry := r.initInstance(p)
+			if ok {
+				if !r.notify(p.instance.SetInitialized) {
+					return
+				}
+			} else if retry {
+				remaining = append(remaining, p)
+			}
+		}
+		pending = remaining
+		if len(pending) == 0 || r.stopped() {
+			return
+		}
+	}
+}
+
+// notify hands f to the gather goroutine, it returns false if the reader stopped
+func (r *InputReader) notify(f func()) bool {
+	select {
+	case r.inits <- f:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// applyInits runs the inits succeeded in background since last gather
+func (r *InputReader) applyInits() {
+	for {
+		select {
+		case f := <-r.inits:
+			f()
+		default:
+			return
+		}
+	}
+}
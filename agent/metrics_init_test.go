@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/backoff"
+	"flashcat.cloud/categraf/types"
+)
+
+type flakyInstance struct {
+	config.InstanceConfig
+	// init fails until attempts reach fails
+	fails    int32
+	attempts atomic.Int32
+}
+
+func (ins *flakyInstance) Init() error {
+	if ins.attempts.Add(1) <= ins.fails {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+type flakyInput struct {
+	config.PluginConfig
+	Instances []*flakyInstance
+}
+
+func (f *flakyInput) Clone() inputs.Input { return &flakyInput{} }
+func (f *flakyInput) Name() string        { return "flaky" }
+
+func (f *flakyInput) GetInstances() []inputs.Instance {
+	ret := make([]inputs.Instance, len(f.Instances))
+	for i := range f.Instances {
+		ret[i] = f.Instances[i]
+	}
+	return ret
+}
+
+func TestReinitFailedInstances(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	initBackoff = backoff.NewPolicy(2, 0.01, 0.05, 1, false)
+	defer func() { initBackoff = backoff.NewPolicy(2, 1, 300, 1, false) }()
+
+	in := &flakyInput{Instances: []*flakyInstance{{}, {fails: 3}}}
+	r := newInputReader("local.flaky", "sum", in)
+	require.True(t, r.initInput())
+	defer r.Stop()
+
+	require.True(t, in.Instances[0].Initialized())
+	require.False(t, in.Instances[1].Initialized())
+
+	// inits succeeded in background are applied by the gather goroutine
+	require.Eventually(t, func() bool {
+		r.applyInits()
+		return in.Instances[1].Initialized()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 4, in.Instances[1].attempts.Load())
+
+	states := inputs.InitStates()
+	require.Len(t, states, 3)
+	for _, st := range states {
+		require.Equal(t, "flaky", st.Input)
+		require.Equal(t, "local", st.Provider)
+		require.Equal(t, "sum", st.Checksum)
+		require.True(t, st.Up)
+	}
+	require.Equal(t, 4, states[2].Attempts)
+}
+
+func TestReinitFailedInput(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	initBackoff = backoff.NewPolicy(2, 0.01, 0.05, 1, false)
+	defer func() { initBackoff = backoff.NewPolicy(2, 1, 300, 1, false) }()
+
+	in := &failingPlugin{fails: 2}
+	r := newInputReader("local.failing", "sum", in)
+	require.True(t, r.initInput())
+	require.False(t, r.inputReady)
+
+	require.Eventually(t, func() bool {
+		r.applyInits()
+		return r.inputReady
+	}, 5*time.Second, 10*time.Millisecond)
+
+	r.Stop()
+	for _, st := range inputs.InitStates() {
+		require.NotEqual(t, "failing", st.Input)
+	}
+}
+
+type failingPlugin struct {
+	config.PluginConfig
+	fails    int32
+	attempts atomic.Int32
+}
+
+func (f *failingPlugin) Clone() inputs.Input      { return &failingPlugin{} }
+func (f *failingPlugin) Name() string             { return "failing" }
+func (f *failingPlugin) Gather(*types.SampleList) {}
+
+func (f *failingPlugin) Init() error {
+	if f.attempts.Add(1) <= f.fails {
+		return errors.New("token missing")
+	}
+	return nil
+}
+
+// blockingInstance fails the first init, and blocks the next one until released
+type blockingInstance struct {
+	config.InstanceConfig
+	attempts atomic.Int32
+	entered  chan struct{}
+	release  chan struct{}
+	dropped  atomic.Bool
+}
+
+func (ins *blockingInstance) Init() error {
+	if ins.attempts.Add(1) == 1 {
+		return errors.New("connection refused")
+	}
+	close(ins.entered)
+	<-ins.release
+	return nil
+}
+
+func (ins *blockingInstance) Drop() { ins.dropped.Store(true) }
+
+type blockingInput struct {
+	config.PluginConfig
+	ins *blockingInstance
+}
+
+func (b *blockingInput) Clone() inputs.Input             { return &blockingInput{} }
+func (b *blockingInput) Name() string                    { return "blocking" }
+func (b *blockingInput) GetInstances() []inputs.Instance { return []inputs.Instance{b.ins} }
+
+func TestReinitAfterStop(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	initBackoff = backoff.NewPolicy(2, 0.01, 0.05, 1, false)
+	defer func() { initBackoff = backoff.NewPolicy(2, 1, 300, 1, false) }()
+
+	ins := &blockingInstance{entered: make(chan struct{}), release: make(chan struct{})}
+	r := newInputReader("local.blocking", "sum", &blockingInput{ins: ins})
+	require.True(t, r.initInput())
+
+	// the reader stops while the instance is being initialized in background
+	<-ins.entered
+	r.Stop()
+	close(ins.release)
+
+	require.Eventually(t, ins.dropped.Load, 5*time.Second, 10*time.Millisecond)
+	for _, st := range inputs.InitStates() {
+		require.NotEqual(t, "blocking", st.Input)
+	}
+}
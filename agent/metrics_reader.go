@@ -1,44 +1,118 @@
 package agent
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"flashcat.cloud/categraf/aggregators"
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/inputs"
 	"flashcat.cloud/categraf/pkg/runtimex"
+	"flashcat.cloud/categraf/processors"
 	"flashcat.cloud/categraf/types"
 	"flashcat.cloud/categraf/writer"
 )
 
 type InputReader struct {
 	inputName  string
+	sum        string
 	input      inputs.Input
+	interval   time.Duration
 	quitChan   chan struct{}
 	runCounter uint64
 	waitGroup  sync.WaitGroup
+
+	// the input itself is initialized, only touched by the gather goroutine
+	inputReady bool
+	// done by the gather goroutine for the inits succeeded in background
+	inits chan func()
+	done  chan struct{}
+	// orders the init states written in background against their removal by Stop
+	initStateLock sync.Mutex
+	// gather right away, without waiting for the interval
+	trigger chan struct{}
+
+	stats gatherStats
+
+	// precision of timestamps, empty for global.precision
+	precision string
+	// stamp samples with the scheduled time of the gather
+	tickTimestamp bool
+
+	// the input ("") and instances whose gather is still running after gather_timeout,
+	// they are skipped until it returns
+	busy struct {
+		sync.Mutex
+		m map[string]struct{}
+	}
 }
 
-func newInputReader(inputName string, in inputs.Input) *InputReader {
+// gatherStats is the result of the last gathers, read by the status api
+type gatherStats struct {
+	sync.Mutex
+	gathers   uint64
+	last      time.Time
+	duration  time.Duration
+	lastError string
+}
+
+func newInputReader(inputName, sum string, in inputs.Input) *InputReader {
 	return &InputReader{
 		inputName: inputName,
+		sum:       sum,
 		input:     in,
 		quitChan:  make(chan struct{}, 1),
+		inits:     make(chan func()),
+		done:      make(chan struct{}),
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// gatherInterval is the interval of the input, or the global one
+func (r *InputReader) gatherInterval() time.Duration {
+	if r.input.GetInterval() > 0 {
+		return time.Duration(r.input.GetInterval())
+	}
+	return config.GetInterval()
+}
+
+// Trigger asks for a gather right away, it returns false if one is pending already
+func (r *InputReader) Trigger() bool {
+	select {
+	case r.trigger <- struct{}{}:
+		return true
+	default:
+		return false
 	}
 }
 
 func (r *InputReader) Stop() {
+	close(r.done)
 	r.quitChan <- struct{}{}
 	inputs.MayDrop(r.input)
+
+	r.initStateLock.Lock()
+	inputs.DelInitStates(r.inputName, r.sum)
+	r.initStateLock.Unlock()
+	inputs.DelGatherCounters(r.inputName, r.sum)
 }
 
-func (r *InputReader) startInput() {
-	interval := config.GetInterval()
-	if r.input.GetInterval() > 0 {
-		interval = time.Duration(r.input.GetInterval())
+func (r *InputReader) stopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
 	}
+}
+
+func (r *InputReader) startInput() {
+	interval := r.gatherInterval()
+	r.interval = interval
 	if si, ok := r.input.(inputs.ServiceInput); ok {
 		slist := types.NewSampleList()
 		err := si.Start(slist)
@@ -47,9 +121,37 @@ func (r *InputReader) startInput() {
 			return
 		}
 	}
-	timer := time.NewTimer(0 * time.Second)
+	r.precision, r.tickTimestamp = timestampOptions(r.input)
+	sched := newSchedule(interval, r.input)
+	tick := sched.first(time.Now())
+	timer := time.NewTimer(sched.delay(tick, time.Now()))
 	defer timer.Stop()
-	var start time.Time
+
+	gather := func() {
+		start := time.Now()
+		if config.Config.DebugMode {
+			log.Println("D!", r.inputName, ": before gather once")
+		}
+		r.stats.Lock()
+		r.stats.lastError = ""
+		r.stats.Unlock()
+
+		r.gatherOnce(tick)
+
+		duration := time.Since(start)
+		r.stats.Lock()
+		r.stats.gathers++
+		r.stats.last = start
+		r.stats.duration = duration
+		r.stats.Unlock()
+		if config.Config.DebugMode {
+			log.Println("D!", r.inputName, ": after gather once,", "duration:", duration)
+		}
+
+		now := time.Now()
+		tick = sched.next(tick, now)
+		timer.Reset(sched.delay(tick, now))
+	}
 
 	for {
 		select {
@@ -57,37 +159,34 @@ func (r *InputReader) startInput() {
 			close(r.quitChan)
 			return
 		case <-timer.C:
-			start = time.Now()
-			if config.Config.DebugMode {
-				log.Println("D!", r.inputName, ": before gather once")
-			}
-
-			r.gatherOnce()
-
-			if config.Config.DebugMode {
-				log.Println("D!", r.inputName, ": after gather once,", "duration:", time.Since(start))
-			}
-
-			next := interval - time.Since(start)
-			if next < 0 {
-				next = 0
-			}
-			timer.Reset(next)
+			gather()
+		case <-r.trigger:
+			// the interval restarts from the triggered gather
+			timer.Stop()
+			tick = time.Now()
+			gather()
 		}
 	}
 }
 
-func (r *InputReader) gatherOnce() {
+// gatherOnce gathers the input and its instances, tick is the scheduled time of the gather
+func (r *InputReader) gatherOnce(tick time.Time) {
 	defer func() {
 		if rc := recover(); rc != nil {
 			log.Println("E!", r.inputName, ": gather metrics panic:", r, string(runtimex.Stack(3)))
+			r.stats.Lock()
+			r.stats.lastError = fmt.Sprint("gather panic: ", rc)
+			r.stats.Unlock()
 		}
 	}()
 
+	r.applyInits()
+	if !r.inputReady {
+		return
+	}
+
 	// plugin level, for system plugins
-	slist := types.NewSampleList()
-	inputs.MayGather(r.input, slist)
-	r.forward(r.input.Process(slist))
+	r.gatherTimeout("", r.input, tick, r.interval)
 
 	instances := inputs.MayGetInstances(r.input)
 	if len(instances) == 0 {
@@ -105,7 +204,7 @@ func (r *InputReader) gatherOnce() {
 		}
 		concurrencyLimiter <- struct{}{}
 		r.waitGroup.Add(1)
-		go func(ins inputs.Instance) {
+		go func(index int, ins inputs.Instance) {
 			defer func() {
 				r.waitGroup.Done()
 				<-concurrencyLimiter
@@ -119,19 +218,132 @@ func (r *InputReader) gatherOnce() {
 				}
 			}
 
-			insList := types.NewSampleList()
-			inputs.MayGather(ins, insList)
-			r.forward(ins.Process(insList))
-		}(instances[i])
+			interval := r.interval
+			if it > 0 {
+				interval *= time.Duration(it)
+			}
+			r.gatherTimeout(inputs.InstanceIndex(index), ins, tick, interval)
+		}(i, instances[i])
 	}
 
 	r.waitGroup.Wait()
 }
 
-func (r *InputReader) forward(slist *types.SampleList) {
+// gatherTimeout gathers t of the input ("") or an instance and forwards the samples. The gather
+// is abandoned after gather_timeout, the samples are dropped then, and t is skipped until the
+// gather returns.
+func (r *InputReader) gatherTimeout(index string, t sampleProcessor, tick time.Time, interval time.Duration) {
+	if !r.setBusy(index) {
+		inputs.AddGatherSkipped(r.inputName, r.sum, index)
+		log.Println("W!", r.inputName, instanceName(index), ": previous gather is still running, skipped")
+		return
+	}
+
+	timeout := inputs.MayGetGatherTimeout(t)
+	if timeout <= 0 && index != "" {
+		timeout = inputs.MayGetGatherTimeout(r.input)
+	}
+	if _, ok := t.(inputs.SampleGatherer); !ok {
+		// nothing to gather, e.g. the plugin level of most inputs
+		timeout = 0
+	}
+	if timeout <= 0 {
+		defer r.clearBusy(index)
+		slist := types.NewSampleList()
+		inputs.MayGather(t, slist)
+		r.forward(r.process(t, slist, tick), interval)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	result := make(chan *types.SampleList, 1)
+	go func() {
+		defer func() {
+			if rc := recover(); rc != nil {
+				log.Println("E!", r.inputName, instanceName(index), ": gather metrics panic:", rc, string(runtimex.Stack(3)))
+				r.stats.Lock()
+				r.stats.lastError = fmt.Sprint("gather panic: ", rc)
+				r.stats.Unlock()
+				result <- nil
+			}
+			cancel()
+			r.clearBusy(index)
+		}()
+		slist := types.NewSampleList()
+		inputs.MayGatherContext(ctx, t, slist)
+		result <- r.process(t, slist, tick)
+	}()
+
+	select {
+	case slist := <-result:
+		r.forward(slist, interval)
+	case <-ctx.Done():
+		inputs.AddGatherTimeout(r.inputName, r.sum, index)
+		log.Println("E!", r.inputName, instanceName(index), ": gather timed out after", timeout)
+		r.stats.Lock()
+		r.stats.lastError = fmt.Sprintf("gather%s timed out after %s", instanceName(index), timeout)
+		r.stats.Unlock()
+	}
+}
+
+func instanceName(index string) string {
+	if index == "" {
+		return ""
+	}
+	return " instance #" + index
+}
+
+// setBusy marks the input or instance gathering, it returns false if it is already
+func (r *InputReader) setBusy(index string) bool {
+	r.busy.Lock()
+	defer r.busy.Unlock()
+	if r.busy.m == nil {
+		r.busy.m = make(map[string]struct{})
+	}
+	if _, has := r.busy.m[index]; has {
+		return false
+	}
+	r.busy.m[index] = struct{}{}
+	return true
+}
+
+func (r *InputReader) clearBusy(index string) {
+	r.busy.Lock()
+	defer r.busy.Unlock()
+	delete(r.busy.m, index)
+}
+
+// sampleProcessor is an input or an instance
+type sampleProcessor interface {
+	Process(*types.SampleList) *types.SampleList
+}
+
+// process runs the samples through the processors of t, the samples without timestamp are
+// stamped with tick if tick_timestamp
+func (r *InputReader) process(t sampleProcessor, slist *types.SampleList, tick time.Time) *types.SampleList {
+	if p, ok := t.(inputs.TimestampProcessor); ok && r.tickTimestamp && !tick.IsZero() {
+		return p.ProcessAt(slist, tick)
+	}
+	return t.Process(slist)
+}
+
+func (r *InputReader) forward(slist *types.SampleList, interval time.Duration) {
 	if slist == nil {
 		return
 	}
-	arr := slist.PopBackAll()
-	writer.WriteSamples(arr)
+	arr := processors.Process(slist.PopBackAll())
+	// samples suppressed by dedup only keep their series fresh on /metrics
+	var suppressed []*types.Sample
+	kept := arr[:0]
+	for _, s := range arr {
+		if s.Suppressed {
+			suppressed = append(suppressed, s)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	arr = aggregators.Push(kept)
+	_, inputKey := inputs.ParseInputName(r.inputName)
+	writer.Expose(inputKey, interval, append(suppressed, arr...))
+	writer.WriteInputSamplesPrecision(inputKey, r.precision, arr)
 }
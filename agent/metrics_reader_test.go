@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/types"
+)
+
+// hungInstance blocks in Gather until release is closed
+type hungInstance struct {
+	config.InstanceConfig
+	release chan struct{}
+	gathers atomic.Int32
+}
+
+func (ins *hungInstance) Gather(*types.SampleList) {
+	ins.gathers.Add(1)
+	<-ins.release
+}
+
+// ctxInstance returns once the gather is canceled
+type ctxInstance struct {
+	config.InstanceConfig
+	canceled atomic.Bool
+}
+
+func (ins *ctxInstance) Gather(slist *types.SampleList) {
+	ins.GatherContext(context.Background(), slist)
+}
+
+func (ins *ctxInstance) GatherContext(ctx context.Context, _ *types.SampleList) {
+	<-ctx.Done()
+	ins.canceled.Store(true)
+}
+
+type quickInstance struct {
+	config.InstanceConfig
+	gathers atomic.Int32
+}
+
+func (ins *quickInstance) Gather(*types.SampleList) {
+	ins.gathers.Add(1)
+}
+
+type timeoutInput struct {
+	config.PluginConfig
+	instances []inputs.Instance
+}
+
+func (f *timeoutInput) Clone() inputs.Input             { return &timeoutInput{} }
+func (f *timeoutInput) Name() string                    { return "timeout" }
+func (f *timeoutInput) GetInstances() []inputs.Instance { return f.instances }
+
+func gatherCounterOf(input, instance string) inputs.GatherCounter {
+	for _, c := range inputs.GatherCounters() {
+		if c.Input == input && c.Instance == instance {
+			return c
+		}
+	}
+	return inputs.GatherCounter{}
+}
+
+func TestGatherTimeout(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+
+	quick := &quickInstance{}
+	hung := &hungInstance{release: make(chan struct{})}
+	withCtx := &ctxInstance{}
+	// the instance overrides the timeout of the input
+	withCtx.GatherTimeout = config.Duration(10 * time.Millisecond)
+	in := &timeoutInput{instances: []inputs.Instance{quick, hung, withCtx}}
+	in.GatherTimeout = config.Duration(50 * time.Millisecond)
+
+	r := newInputReader("local.timeout", "sum", in)
+	require.True(t, r.initInput())
+
+	start := time.Now()
+	r.gatherOnce(time.Time{})
+	require.Less(t, time.Since(start), time.Second)
+	require.EqualValues(t, 1, quick.gathers.Load())
+	require.Eventually(t, withCtx.canceled.Load, time.Second, 5*time.Millisecond)
+	require.EqualValues(t, 1, gatherCounterOf("timeout", "1").Timeouts)
+	require.EqualValues(t, 1, gatherCounterOf("timeout", "2").Timeouts)
+
+	// the hung instance is skipped while its gather is running, the others go on
+	r.gatherOnce(time.Time{})
+	require.EqualValues(t, 2, quick.gathers.Load())
+	require.EqualValues(t, 1, hung.gathers.Load())
+	require.EqualValues(t, 1, gatherCounterOf("timeout", "1").Skipped)
+
+	close(hung.release)
+	require.Eventually(t, func() bool {
+		r.gatherOnce(time.Time{})
+		return hung.gathers.Load() == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Zero(t, gatherCounterOf("timeout", "0").Timeouts)
+
+	// the counters of a reader of another checksum outlive those of the stopped one
+	inputs.AddGatherTimeout("local.timeout", "other", "1")
+	defer inputs.DelGatherCounters("local.timeout", "other")
+	r.Stop()
+	require.EqualValues(t, 1, gatherCounterOf("timeout", "1").Timeouts)
+	require.Zero(t, gatherCounterOf("timeout", "2").Timeouts)
+}
+
+func TestTickTimestamp(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	if config.HostInfo == nil {
+		config.HostInfo = &config.HostInfoCache{}
+	}
+
+	quick := &quickInstance{}
+	in := &timeoutInput{instances: []inputs.Instance{quick}}
+	tickTimestamp := true
+	in.TickTimestamp = &tickTimestamp
+	in.Precision = "s"
+
+	r := newInputReader("local.timeout", "sum", in)
+	r.precision, r.tickTimestamp = timestampOptions(in)
+	require.Equal(t, "s", r.precision)
+	require.True(t, r.tickTimestamp)
+
+	tick := time.Now().Add(-3 * time.Second)
+	own := time.Now().Add(-time.Hour)
+	slist := types.NewSampleList()
+	slist.PushSample("", "gathered", 1)
+	slist.PushFront(types.NewSample("", "stamped", 1).SetTime(own))
+
+	samples := r.process(quick, slist, tick).PopBackAll()
+	require.Len(t, samples, 2)
+	for _, s := range samples {
+		if s.Metric == "stamped" {
+			require.Equal(t, own, s.Timestamp)
+		} else {
+			require.Equal(t, tick, s.Timestamp)
+		}
+	}
+
+	// without tick_timestamp samples are stamped when processed
+	r.tickTimestamp = false
+	slist.PushSample("", "gathered", 1)
+	samples = r.process(quick, slist, tick).PopBackAll()
+	require.True(t, samples[0].Timestamp.After(tick))
+}
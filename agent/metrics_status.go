@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"flashcat.cloud/categraf/inputs"
+)
+
+// metricsAgent is the running metrics agent, for the status api
+var metricsAgent atomic.Pointer[MetricsAgent]
+
+var ErrMetricsAgentNotRunning = errors.New("metrics agent is not running")
+
+type (
+	// InputStatus is the state of a running input
+	InputStatus struct {
+		Name       string     `json:"name"`
+		Provider   string     `json:"provider"`
+		Checksum   string     `json:"checksum"`
+		Interval   string     `json:"interval"`
+		Up         bool       `json:"up"`
+		InitError  string     `json:"init_error,omitempty"`
+		Gathers    uint64     `json:"gathers"`
+		LastGather *time.Time `json:"last_gather,omitempty"`
+		// duration of the last gather
+		Duration  string           `json:"duration"`
+		LastError string           `json:"last_error,omitempty"`
+		Instances []InstanceStatus `json:"instances,omitempty"`
+	}
+
+	// InstanceStatus is the init state of an instance
+	InstanceStatus struct {
+		Index        string            `json:"index"`
+		Labels       map[string]string `json:"labels,omitempty"`
+		Up           bool              `json:"up"`
+		InitAttempts int               `json:"init_attempts"`
+		InitError    string            `json:"init_error,omitempty"`
+	}
+)
+
+func (r *InputReader) status() InputStatus {
+	provider, inputKey := inputs.ParseInputName(r.inputName)
+	st := InputStatus{
+		Name:     inputKey,
+		Provider: provider,
+		Checksum: r.sum,
+		Interval: r.gatherInterval().String(),
+		Up:       true,
+	}
+
+	r.stats.Lock()
+	st.Gathers = r.stats.gathers
+	if !r.stats.last.IsZero() {
+		last := r.stats.last
+		st.LastGather = &last
+	}
+	st.Duration = r.stats.duration.String()
+	st.LastError = r.stats.lastError
+	r.stats.Unlock()
+
+	states := inputs.InitStatesOf(r.inputName, r.sum)
+	if s, has := states[""]; has {
+		st.Up = s.Up
+		st.InitError = s.LastError
+		delete(states, "")
+	}
+	if !st.Up {
+		return st
+	}
+
+	instances := inputs.MayGetInstances(r.input)
+	for i := range instances {
+		s, has := states[inputs.InstanceIndex(i)]
+		if !has {
+			// invalid internal config, never inited
+			continue
+		}
+		st.Instances = append(st.Instances, InstanceStatus{
+			Index:        s.Instance,
+			Labels:       instances[i].GetLabels(),
+			Up:           s.Up,
+			InitAttempts: s.Attempts,
+			InitError:    s.LastError,
+		})
+	}
+	return st
+}
+
+// InputStatuses returns the states of all running inputs
+func InputStatuses() ([]InputStatus, error) {
+	ma := metricsAgent.Load()
+	if ma == nil {
+		return nil, ErrMetricsAgentNotRunning
+	}
+	readers := ma.InputReaders.List()
+	ret := make([]InputStatus, 0, len(readers))
+	for _, r := range readers {
+		ret = append(ret, r.status())
+	}
+	return ret, nil
+}
+
+// runningReaders returns the readers of name, which is an input like mysql, or an input
+// of a provider like local.mysql
+func (ma *MetricsAgent) runningReaders(name string) []*InputReader {
+	provider, inputKey := inputs.ParseInputName(name)
+	var ret []*InputReader
+	for _, r := range ma.InputReaders.List() {
+		p, k := inputs.ParseInputName(r.inputName)
+		if k == inputKey && (provider == "" || p == provider) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// ReloadInput reads the configs of input name from its provider again, and restarts it
+func ReloadInput(name string) error {
+	ma := metricsAgent.Load()
+	if ma == nil {
+		return ErrMetricsAgentNotRunning
+	}
+	readers := ma.runningReaders(name)
+	if len(readers) == 0 {
+		return fmt.Errorf("input %s is not running", name)
+	}
+
+	// an input has a reader for every checksum, they are reloaded together
+	names := make(map[string]struct{})
+	for _, r := range readers {
+		names[r.inputName] = struct{}{}
+	}
+	// the configs are read and the readers replaced at once, or a provider reloading meanwhile
+	// may register the input as well
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
+	for fullName := range names {
+		typ, inputKey := inputs.ParseInputName(fullName)
+		var provider inputs.Provider
+		for i := range ma.InputProviders {
+			if ma.InputProviders[i].Name() == typ {
+				provider = ma.InputProviders[i]
+			}
+		}
+		if provider == nil {
+			return fmt.Errorf("input provider %s not found", typ)
+		}
+		configs, err := provider.GetInputConfig(inputKey)
+		if err != nil {
+			return fmt.Errorf("failed to get configuration of input %s: %v", fullName, err)
+		}
+		log.Println("I! reload input:", fullName)
+		ma.deregisterInput(fullName, "")
+		if len(configs) > 0 {
+			ma.registerInput(fullName, configs)
+		}
+	}
+	return nil
+}
+
+// GatherInput gathers input name right away, it returns the number of inputs triggered
+func GatherInput(name string) (int, error) {
+	ma := metricsAgent.Load()
+	if ma == nil {
+		return 0, ErrMetricsAgentNotRunning
+	}
+	readers := ma.runningReaders(name)
+	if len(readers) == 0 {
+		return 0, fmt.Errorf("input %s is not running", name)
+	}
+
+	triggered := 0
+	for _, r := range readers {
+		if r.Trigger() {
+			triggered++
+		}
+	}
+	return triggered, nil
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestInputStatuses(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	ma := &MetricsAgent{InputReaders: NewReaders()}
+	metricsAgent.Store(ma)
+	defer metricsAgent.Store(nil)
+
+	in := &flakyInput{Instances: []*flakyInstance{{}, {fails: 100}}}
+	r := newInputReader("local.flaky", "sum", in)
+	require.True(t, r.initInput())
+	defer r.Stop()
+	ma.InputReaders.Add("local.flaky", "sum", r)
+
+	statuses, err := InputStatuses()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	st := statuses[0]
+	require.Equal(t, "flaky", st.Name)
+	require.Equal(t, "local", st.Provider)
+	require.True(t, st.Up)
+	require.Len(t, st.Instances, 2)
+	require.True(t, st.Instances[0].Up)
+	require.False(t, st.Instances[1].Up)
+	require.Equal(t, "connection refused", st.Instances[1].InitError)
+
+	n, err := GatherInput("flaky")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	// one gather is pending already
+	n, err = GatherInput("local.flaky")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	_, err = GatherInput("http.flaky")
+	require.Error(t, err)
+}
+
+func TestReadersAddReplaces(t *testing.T) {
+	readers := NewReaders()
+	old := newInputReader("local.flaky", "sum", &flakyInput{})
+	readers.Add("local.flaky", "sum", old)
+	r := newInputReader("local.flaky", "sum", &flakyInput{})
+	readers.Add("local.flaky", "sum", r)
+
+	require.True(t, old.stopped())
+	require.False(t, r.stopped())
+	m, _ := readers.GetInput("local.flaky")
+	require.Equal(t, r, m["sum"])
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/runtimex"
+	"flashcat.cloud/categraf/processors"
+	"flashcat.cloud/categraf/types"
+	"flashcat.cloud/categraf/writer"
+)
+
+// OnceResult is the result of gathering an input, or one of its instances, once
+type OnceResult struct {
+	Input string `json:"input"`
+	// Instance is the index of the instance, empty for the plugin level gather
+	Instance string          `json:"instance,omitempty"`
+	Duration time.Duration   `json:"-"`
+	Error    string          `json:"error,omitempty"`
+	Samples  []*types.Sample `json:"-"`
+}
+
+func (r OnceResult) String() string {
+	name := r.Input
+	if r.Instance != "" {
+		name += " instance #" + r.Instance
+	}
+	if r.Error != "" {
+		return fmt.Sprintf("%s: %s (%s)", name, r.Error, r.Duration)
+	}
+	return fmt.Sprintf("%s: %d samples (%s)", name, len(r.Samples), r.Duration)
+}
+
+// Once loads the inputs through the providers and gathers every input and instance once,
+// one after another. Service inputs can not be gathered this way and are skipped.
+func Once() []OnceResult {
+	c := config.Config
+	providers, err := newNopProviders(c)
+	if err != nil {
+		return []OnceResult{{Error: err.Error()}}
+	}
+	filters := parseFilter(c.InputFilters)
+
+	var results []OnceResult
+	for _, p := range providers {
+		if _, err := p.LoadConfig(); err != nil {
+			log.Println("E! provider", p.Name(), "failed to load configs:", err)
+		}
+		names, err := p.GetInputs()
+		if err != nil {
+			results = append(results, OnceResult{Input: p.Name(), Error: fmt.Sprint("failed to list inputs: ", err)})
+			continue
+		}
+		sort.Strings(names)
+
+		for _, inputKey := range names {
+			if _, has := filters[inputKey]; len(filters) > 0 && !has {
+				continue
+			}
+			name := inputs.FormatInputName(p.Name(), inputKey)
+			creator, has := inputs.InputCreators[inputKey]
+			if !has {
+				results = append(results, OnceResult{Input: name, Error: "not supported"})
+				continue
+			}
+			configs, err := p.GetInputConfig(inputKey)
+			if err != nil {
+				results = append(results, OnceResult{Input: name, Error: fmt.Sprint("failed to get configuration: ", err)})
+				continue
+			}
+			loaded, err := p.LoadInputConfig(configs, creator())
+			if err != nil {
+				results = append(results, OnceResult{Input: name, Error: fmt.Sprint("failed to load configuration: ", err)})
+				continue
+			}
+			for _, sum := range sortedKeys(loaded) {
+				results = append(results, gatherInputOnce(name, loaded[sum])...)
+			}
+		}
+	}
+	return results
+}
+
+func gatherInputOnce(name string, input inputs.Input) []OnceResult {
+	failed := func(instance string, err error) []OnceResult {
+		return []OnceResult{{Input: name, Instance: instance, Error: err.Error()}}
+	}
+	if err := input.InitInternalConfig(); err != nil {
+		return failed("", err)
+	}
+	if _, ok := input.(inputs.ServiceInput); ok {
+		log.Println("I! service input", name, "can not be gathered once, skipped")
+		return nil
+	}
+	defer inputs.MayDrop(input)
+
+	start := time.Now()
+	err := inputs.MayInit(input)
+	if errors.Is(err, types.ErrInstancesEmpty) {
+		log.Println("W! no instances for input:", name)
+		return nil
+	}
+	if err != nil {
+		r := failed("", err)
+		r[0].Duration = time.Since(start)
+		return r
+	}
+
+	var results []OnceResult
+	instances := inputs.MayGetInstances(input)
+	if _, ok := input.(inputs.SampleGatherer); ok || instances == nil {
+		results = append(results, gatherOnce(name, "", input, input.Process))
+	}
+	for i, ins := range instances {
+		index := inputs.InstanceIndex(i)
+		if err := ins.InitInternalConfig(); err != nil {
+			results = append(results, failed(index, err)...)
+			continue
+		}
+		start := time.Now()
+		err := inputs.MayInit(ins)
+		if errors.Is(err, types.ErrInstancesEmpty) {
+			continue
+		}
+		if err != nil {
+			r := failed(index, err)
+			r[0].Duration = time.Since(start)
+			results = append(results, r...)
+			continue
+		}
+		results = append(results, gatherOnce(name, index, ins, ins.Process))
+	}
+	return results
+}
+
+// gatherOnce gathers t and runs the samples through the processors, panics are errors
+func gatherOnce(name, index string, t interface{}, process func(*types.SampleList) *types.SampleList) (r OnceResult) {
+	r = OnceResult{Input: name, Instance: index}
+	start := time.Now()
+	defer func() {
+		r.Duration = time.Since(start)
+		if rc := recover(); rc != nil {
+			log.Println("E!", name, ": gather metrics panic:", rc, string(runtimex.Stack(3)))
+			r.Error = fmt.Sprint("gather panic: ", rc)
+		}
+	}()
+
+	slist := types.NewSampleList()
+	inputs.MayGather(t, slist)
+	r.Samples = processors.Process(process(slist).PopBackAll())
+	return r
+}
+
+// onceDocument is the json output of PrintOnce
+type onceDocument struct {
+	OnceResult
+	DurationMs float64         `json:"duration_ms"`
+	Samples    json.RawMessage `json:"samples"`
+}
+
+// PrintOnce writes the samples of results to out in the format. Json documents carry the
+// timing and error of every result, for the other formats they are written to report.
+func PrintOnce(out, report io.Writer, format string, results []OnceResult) error {
+	if format == writer.FormatJSON {
+		docs := make([]onceDocument, 0, len(results))
+		for _, r := range results {
+			var buf bytes.Buffer
+			if err := writer.FormatSamples(&buf, format, r.Samples); err != nil {
+				return err
+			}
+			docs = append(docs, onceDocument{
+				OnceResult: r,
+				DurationMs: float64(r.Duration.Microseconds()) / 1000,
+				Samples:    buf.Bytes(),
+			})
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(docs)
+	}
+
+	var samples []*types.Sample
+	for _, r := range results {
+		fmt.Fprintln(report, r)
+		samples = append(samples, r.Samples...)
+	}
+	return writer.FormatSamples(out, format, samples)
+}
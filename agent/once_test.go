@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/writer"
+)
+
+func TestOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, "config.toml", `
+[global]
+interval = 15
+`)
+	writeConf(t, dir, "input.mem/mem.toml", `
+metrics_name_prefix = "once_"
+`)
+	writeConf(t, dir, "input.net/net.toml", `
+[[relabel_configs]]
+source_labels = ["interface"]
+regex = "(eth"
+`)
+	// statsd is a service input, it is skipped instead of failed
+	writeConf(t, dir, "input.statsd/statsd.toml", `
+service_address = ":0"
+`)
+	require.NoError(t, config.InitConfig(dir, 0, false, false, 0, "mem:net:statsd"))
+
+	results := Once()
+	require.Len(t, results, 2, "%v", results)
+	require.Equal(t, "local.mem", results[0].Input)
+	require.Empty(t, results[0].Error)
+	require.NotEmpty(t, results[0].Samples)
+	require.True(t, strings.HasPrefix(results[0].Samples[0].Metric, "once_mem_"))
+	require.Equal(t, "local.net", results[1].Input)
+	require.Contains(t, results[1].Error, "compile error")
+
+	var out, report bytes.Buffer
+	require.NoError(t, PrintOnce(&out, &report, writer.FormatJSON, results))
+	var docs []struct {
+		Input   string            `json:"input"`
+		Error   string            `json:"error"`
+		Samples []json.RawMessage `json:"samples"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &docs))
+	require.Len(t, docs, 2)
+	require.Len(t, docs[0].Samples, len(results[0].Samples))
+	require.NotEmpty(t, docs[1].Error)
+	require.Empty(t, report.String())
+
+	out.Reset()
+	require.NoError(t, PrintOnce(&out, &report, writer.FormatInflux, results))
+	require.True(t, strings.HasPrefix(out.String(), "once_mem_"))
+	require.Contains(t, report.String(), "local.net: ")
+	require.Contains(t, report.String(), "local.mem: ")
+}
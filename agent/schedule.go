@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"math/rand"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+)
+
+// schedule decides when an input gathers. Ticks are every interval, aligned to the
+// interval boundaries if round, and each gather waits a random jitter after its tick
+// so that agents started at the same time do not hit the targets at the same second.
+type schedule struct {
+	interval time.Duration
+	jitter   time.Duration
+	round    bool
+}
+
+// newSchedule uses collection_jitter and round_interval of the input, or the global ones
+func newSchedule(interval time.Duration, input inputs.Input) schedule {
+	s := schedule{
+		interval: interval,
+		jitter:   time.Duration(config.Config.Global.CollectionJitter),
+		round:    config.Config.Global.RoundInterval,
+	}
+	if getter, ok := input.(inputs.ScheduleGetter); ok {
+		if jitter := getter.GetCollectionJitter(); jitter > 0 {
+			s.jitter = time.Duration(jitter)
+		}
+		if round := getter.GetRoundInterval(); round != nil {
+			s.round = *round
+		}
+	}
+	if s.jitter > s.interval {
+		s.jitter = s.interval
+	}
+	return s
+}
+
+// first returns the first tick, right now unless aligned
+func (s schedule) first(now time.Time) time.Time {
+	if s.round {
+		return now.Truncate(s.interval).Add(s.interval)
+	}
+	return now
+}
+
+// next returns the tick after tick, the ticks missed by a slow gather are skipped
+func (s schedule) next(tick, now time.Time) time.Time {
+	if s.round {
+		return now.Truncate(s.interval).Add(s.interval)
+	}
+	tick = tick.Add(s.interval)
+	if tick.Before(now) {
+		return now
+	}
+	return tick
+}
+
+// delay returns how long to wait from now for the gather of tick
+func (s schedule) delay(tick, now time.Time) time.Duration {
+	d := tick.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	if s.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	return d
+}
+
+// timestampOptions returns precision and tick_timestamp of the input, or the global ones
+func timestampOptions(input inputs.Input) (string, bool) {
+	precision, tick := "", config.Config.Global.TickTimestamp
+	if getter, ok := input.(inputs.TimestampGetter); ok {
+		precision = getter.GetPrecision()
+		if t := getter.GetTickTimestamp(); t != nil {
+			tick = *t
+		}
+	}
+	return precision, tick
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestSchedule(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	global := config.Config.Global
+	defer func() { config.Config.Global = global }()
+	config.Config.Global.CollectionJitter = config.Duration(time.Minute)
+	config.Config.Global.RoundInterval = true
+
+	now := time.Date(2024, 5, 1, 10, 0, 7, 0, time.UTC)
+	interval := 15 * time.Second
+
+	// global settings, jitter is capped by the interval
+	in := &timeoutInput{}
+	s := newSchedule(interval, in)
+	require.Equal(t, interval, s.jitter)
+	require.True(t, s.round)
+
+	tick := s.first(now)
+	require.Equal(t, now.Add(8*time.Second), tick)
+	for i := 0; i < 10; i++ {
+		d := s.delay(tick, now)
+		require.GreaterOrEqual(t, d, 8*time.Second)
+		require.Less(t, d, 23*time.Second)
+	}
+	// a gather overrunning the next boundary waits for the one after
+	require.Equal(t, now.Add(23*time.Second), s.next(tick, now.Add(9*time.Second)))
+
+	// the input overrides the global settings
+	round := false
+	in.RoundInterval = &round
+	in.CollectionJitter = config.Duration(time.Second)
+	s = newSchedule(interval, in)
+	require.Equal(t, time.Second, s.jitter)
+	require.False(t, s.round)
+
+	tick = s.first(now)
+	require.Equal(t, now, tick)
+	require.Equal(t, now.Add(interval), s.next(tick, now.Add(2*time.Second)))
+	require.Equal(t, now.Add(20*time.Second), s.next(tick, now.Add(20*time.Second)))
+	require.Less(t, s.delay(tick, now.Add(time.Second)), time.Second)
+}
@@ -0,0 +1,148 @@
+package aggregators
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/types"
+	"flashcat.cloud/categraf/writer"
+)
+
+// Aggregator rolls up the samples of a period, Add and Flush are never called at the same time
+type Aggregator interface {
+	Add(s *types.Sample, value float64)
+	// Flush returns the rollups of the period ended at now and starts a new period
+	Flush(now time.Time) []*types.Sample
+}
+
+type Creator func(opt config.AggregatorOption) (Aggregator, error)
+
+var AggregatorCreators = map[string]Creator{}
+
+// Add registers an aggregator type, it is referred by `type` of [[aggregators]]
+func Add(typ string, creator Creator) {
+	AggregatorCreators[typ] = creator
+}
+
+type runner struct {
+	sync.Mutex
+	name       string
+	opt        config.AggregatorOption
+	filter     filter.Filter
+	aggregator Aggregator
+}
+
+var runners []*runner
+
+// Init creates the aggregators of [[aggregators]] and starts flushing them every period
+func Init() error {
+	var err error
+	if runners, err = newRunners(); err != nil {
+		return err
+	}
+	for _, r := range runners {
+		go r.loop()
+	}
+	return nil
+}
+
+// Check validates the aggregators of config without starting them
+func Check() error {
+	_, err := newRunners()
+	return err
+}
+
+func newRunners() ([]*runner, error) {
+	var runners []*runner
+	for i, opt := range config.Config.Aggregators {
+		creator, has := AggregatorCreators[opt.Type]
+		if !has {
+			return nil, fmt.Errorf("aggregator type %s not supported", opt.Type)
+		}
+		if len(opt.Metrics) == 0 {
+			return nil, fmt.Errorf("aggregator #%d(%s): metrics is empty", i, opt.Type)
+		}
+		f, err := filter.Compile(opt.Metrics)
+		if err != nil {
+			return nil, fmt.Errorf("aggregator #%d(%s) metrics: %v", i, opt.Type, err)
+		}
+		a, err := creator(opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create aggregator #%d(%s): %v", i, opt.Type, err)
+		}
+		runners = append(runners, &runner{
+			name:       fmt.Sprintf("%s#%d", opt.Type, i),
+			opt:        opt,
+			filter:     f,
+			aggregator: a,
+		})
+	}
+	return runners, nil
+}
+
+// Push hands samples to the aggregators matching them, the returned samples are
+// the ones still to be written
+func Push(samples []*types.Sample) []*types.Sample {
+	if len(runners) == 0 {
+		return samples
+	}
+
+	ret := make([]*types.Sample, 0, len(samples))
+	for _, s := range samples {
+		drop := false
+		for _, r := range runners {
+			if !r.filter.Match(s.Metric) {
+				continue
+			}
+			v, err := conv.ToFloat64(s.Value)
+			if err != nil {
+				continue
+			}
+			r.Lock()
+			r.aggregator.Add(s, v)
+			r.Unlock()
+			drop = drop || r.opt.DropOriginal
+		}
+		if !drop {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func (r *runner) loop() {
+	ticker := time.NewTicker(time.Duration(r.opt.Period))
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r.Lock()
+		samples := r.aggregator.Flush(now)
+		r.Unlock()
+		if config.Config.DebugMode {
+			log.Println("D! aggregator", r.name, "flush", len(samples), "samples")
+		}
+		writer.WriteInputSamples("aggregator", samples)
+	}
+}
+
+// series is the identity of the samples being aggregated together
+type series struct {
+	metric string
+	labels map[string]string
+}
+
+func newSeries(s *types.Sample) series {
+	labels := make(map[string]string, len(s.Labels))
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	return series{metric: s.Metric, labels: labels}
+}
+
+func (se series) sample(suffix string, value float64, now time.Time, extra ...map[string]string) *types.Sample {
+	return types.NewSample("", se.metric+suffix, value, append([]map[string]string{se.labels}, extra...)...).SetTime(now)
+}
@@ -0,0 +1,112 @@
+package aggregators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/types"
+)
+
+func flushByName(a Aggregator) map[string]*types.Sample {
+	ret := map[string]*types.Sample{}
+	for _, s := range a.Flush(time.Now()) {
+		key := s.Metric
+		if q, has := s.Labels["quantile"]; has {
+			key += "/" + q
+		}
+		if le, has := s.Labels["le"]; has {
+			key += "/" + le
+		}
+		ret[key] = s
+	}
+	return ret
+}
+
+func TestBasicStats(t *testing.T) {
+	a, err := newBasicStats(config.AggregatorOption{
+		Stats:     []string{"min", "max", "mean", "count", "sum"},
+		Quantiles: []float64{0.5},
+	})
+	require.NoError(t, err)
+
+	for _, v := range []float64{4, 1, 3, 2} {
+		s := types.NewSample("ping", "rtt", v, map[string]string{"target": "a"})
+		a.Add(s, v)
+	}
+
+	got := flushByName(a)
+	require.Equal(t, 1.0, got["ping_rtt_min"].Value)
+	require.Equal(t, 4.0, got["ping_rtt_max"].Value)
+	require.Equal(t, 2.5, got["ping_rtt_mean"].Value)
+	require.Equal(t, 4.0, got["ping_rtt_count"].Value)
+	require.Equal(t, 10.0, got["ping_rtt_sum"].Value)
+	require.Equal(t, 2.5, got["ping_rtt_quantile/0.5"].Value)
+	require.Equal(t, "a", got["ping_rtt_min"].Labels["target"])
+
+	// a new period starts after flush
+	require.Empty(t, a.Flush(time.Now()))
+}
+
+func TestHistogram(t *testing.T) {
+	a, err := newHistogram(config.AggregatorOption{Buckets: []float64{1, 0.1}})
+	require.NoError(t, err)
+
+	for _, v := range []float64{0.05, 0.5, 0.7, 3} {
+		a.Add(types.NewSample("", "latency", v), v)
+	}
+
+	got := flushByName(a)
+	require.Equal(t, 1.0, got["latency_bucket/0.1"].Value)
+	require.Equal(t, 3.0, got["latency_bucket/1"].Value)
+	require.Equal(t, 4.0, got["latency_bucket/+Inf"].Value)
+	require.Equal(t, 4.0, got["latency_count"].Value)
+	require.Equal(t, types.Histogram, got["latency_count"].Type)
+
+	// cumulative across flushes
+	a.Add(types.NewSample("", "latency", 0.05), 0.05)
+	got = flushByName(a)
+	require.Equal(t, 2.0, got["latency_bucket/0.1"].Value)
+	require.Equal(t, 5.0, got["latency_count"].Value)
+}
+
+func TestHistogramExpire(t *testing.T) {
+	a, err := newHistogram(config.AggregatorOption{Buckets: []float64{1}, Expire: config.Duration(time.Minute)})
+	require.NoError(t, err)
+
+	now := time.Now()
+	a.Add(types.NewSample("", "latency", 0.5), 0.5)
+	require.Len(t, a.Flush(now), 4)
+	require.Len(t, a.Flush(now.Add(time.Minute)), 4)
+	require.Empty(t, a.Flush(now.Add(2*time.Minute)))
+}
+
+func TestHistogramReset(t *testing.T) {
+	a, err := newHistogram(config.AggregatorOption{Buckets: []float64{1}, Reset: true})
+	require.NoError(t, err)
+
+	a.Add(types.NewSample("", "latency", 0.5), 0.5)
+	got := flushByName(a)
+	require.Equal(t, 1.0, got["latency_bucket/1"].Value)
+	require.Equal(t, types.Gauge, got["latency_bucket/1"].Type)
+	require.Empty(t, a.Flush(time.Now()))
+}
+
+func TestPushDropOriginal(t *testing.T) {
+	a, err := newBasicStats(config.AggregatorOption{})
+	require.NoError(t, err)
+	f, err := filter.Compile([]string{"ping_*"})
+	require.NoError(t, err)
+	runners = []*runner{{opt: config.AggregatorOption{DropOriginal: true}, filter: f, aggregator: a}}
+	defer func() { runners = nil }()
+
+	ss := Push([]*types.Sample{
+		types.NewSample("", "ping_rtt", 1),
+		types.NewSample("", "cpu_idle", 1),
+	})
+	require.Len(t, ss, 1)
+	require.Equal(t, "cpu_idle", ss[0].Metric)
+}
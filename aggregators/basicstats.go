@@ -0,0 +1,119 @@
+package aggregators
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+var defaultStats = []string{"min", "max", "mean", "count", "sum"}
+
+type basicStatsSeries struct {
+	series
+	min, max, sum float64
+	count         int
+	values        []float64
+}
+
+// basicStats emits <metric>_min, _max, _mean, _count, _sum and
+// <metric>_quantile{quantile="0.99"} of every series over a period
+type basicStats struct {
+	stats     map[string]bool
+	quantiles []float64
+	cache     map[string]*basicStatsSeries
+}
+
+func init() {
+	Add("basicstats", newBasicStats)
+}
+
+func newBasicStats(opt config.AggregatorOption) (Aggregator, error) {
+	names := opt.Stats
+	if len(names) == 0 && len(opt.Quantiles) == 0 {
+		names = defaultStats
+	}
+	stats := make(map[string]bool, len(names))
+	for _, name := range names {
+		switch name {
+		case "min", "max", "mean", "count", "sum":
+			stats[name] = true
+		default:
+			return nil, fmt.Errorf("unknown stat: %s", name)
+		}
+	}
+	for _, q := range opt.Quantiles {
+		if q < 0 || q > 1 {
+			return nil, fmt.Errorf("quantile %v is not between 0 and 1", q)
+		}
+	}
+	return &basicStats{
+		stats:     stats,
+		quantiles: opt.Quantiles,
+		cache:     make(map[string]*basicStatsSeries),
+	}, nil
+}
+
+func (b *basicStats) Add(s *types.Sample, value float64) {
+	key := s.SeriesKey()
+	bs, has := b.cache[key]
+	if !has {
+		bs = &basicStatsSeries{series: newSeries(s), min: math.Inf(1), max: math.Inf(-1)}
+		b.cache[key] = bs
+	}
+	bs.min = math.Min(bs.min, value)
+	bs.max = math.Max(bs.max, value)
+	bs.sum += value
+	bs.count++
+	if len(b.quantiles) > 0 {
+		bs.values = append(bs.values, value)
+	}
+}
+
+func (b *basicStats) Flush(now time.Time) []*types.Sample {
+	ret := make([]*types.Sample, 0, len(b.cache)*(len(b.stats)+len(b.quantiles)))
+	for _, bs := range b.cache {
+		if b.stats["min"] {
+			ret = append(ret, bs.sample("_min", bs.min, now).SetType(types.Gauge))
+		}
+		if b.stats["max"] {
+			ret = append(ret, bs.sample("_max", bs.max, now).SetType(types.Gauge))
+		}
+		if b.stats["mean"] {
+			ret = append(ret, bs.sample("_mean", bs.sum/float64(bs.count), now).SetType(types.Gauge))
+		}
+		if b.stats["count"] {
+			ret = append(ret, bs.sample("_count", float64(bs.count), now).SetType(types.Gauge))
+		}
+		if b.stats["sum"] {
+			ret = append(ret, bs.sample("_sum", bs.sum, now).SetType(types.Gauge))
+		}
+		if len(b.quantiles) > 0 {
+			sort.Float64s(bs.values)
+			for _, q := range b.quantiles {
+				ret = append(ret, bs.sample("_quantile", quantile(bs.values, q), now,
+					map[string]string{"quantile": strconv.FormatFloat(q, 'f', -1, 64)}).SetType(types.Gauge))
+			}
+		}
+	}
+	b.cache = make(map[string]*basicStatsSeries)
+	return ret
+}
+
+// quantile interpolates linearly between the closest ranks of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
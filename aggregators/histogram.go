@@ -0,0 +1,105 @@
+package aggregators
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+// cumulative series not updated within defaultExpire are forgotten
+const defaultExpire = 10 * time.Minute
+
+type histogramSeries struct {
+	series
+	counts []uint64
+	sum    float64
+	count  uint64
+	// updated since the last flush, and the last flush it was
+	updated  bool
+	lastSeen time.Time
+}
+
+// histogram counts the values of every series into buckets, it emits <metric>_bucket{le="..."},
+// <metric>_sum and <metric>_count. The counts are cumulative like those of prometheus, unless
+// reset starts them from zero every period and emits them as gauges.
+type histogram struct {
+	buckets []float64
+	reset   bool
+	expire  time.Duration
+	cache   map[string]*histogramSeries
+}
+
+func init() {
+	Add("histogram", newHistogram)
+}
+
+func newHistogram(opt config.AggregatorOption) (Aggregator, error) {
+	if len(opt.Buckets) == 0 {
+		return nil, errors.New("buckets is empty")
+	}
+	buckets := append([]float64(nil), opt.Buckets...)
+	sort.Float64s(buckets)
+	expire := time.Duration(opt.Expire)
+	if expire <= 0 {
+		expire = defaultExpire
+	}
+	return &histogram{
+		buckets: buckets,
+		reset:   opt.Reset,
+		expire:  expire,
+		cache:   make(map[string]*histogramSeries),
+	}, nil
+}
+
+func (h *histogram) Add(s *types.Sample, value float64) {
+	key := s.SeriesKey()
+	hs, has := h.cache[key]
+	if !has {
+		hs = &histogramSeries{series: newSeries(s), counts: make([]uint64, len(h.buckets))}
+		h.cache[key] = hs
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hs.counts[i]++
+	}
+	hs.sum += value
+	hs.count++
+	hs.updated = true
+}
+
+func (h *histogram) Flush(now time.Time) []*types.Sample {
+	typ := types.Histogram
+	if h.reset {
+		typ = types.Gauge
+	}
+	ret := make([]*types.Sample, 0, len(h.cache)*(len(h.buckets)+3))
+	for key, hs := range h.cache {
+		if hs.updated {
+			hs.updated = false
+			hs.lastSeen = now
+		} else if now.Sub(hs.lastSeen) > h.expire {
+			delete(h.cache, key)
+			continue
+		}
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hs.counts[i]
+			ret = append(ret, hs.sample("_bucket", float64(cumulative), now,
+				map[string]string{"le": strconv.FormatFloat(upper, 'f', -1, 64)}).SetType(typ))
+		}
+		ret = append(ret,
+			hs.sample("_bucket", float64(hs.count), now, map[string]string{"le": strconv.FormatFloat(math.Inf(1), 'f', -1, 64)}).SetType(typ),
+			hs.sample("_sum", hs.sum, now).SetType(typ),
+			hs.sample("_count", float64(hs.count), now).SetType(typ),
+		)
+	}
+	if h.reset {
+		h.cache = make(map[string]*histogramSeries)
+	}
+	return ret
+}
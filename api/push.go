@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/processors"
+	"flashcat.cloud/categraf/types"
+	"flashcat.cloud/categraf/writer"
+)
+
+// queueFull answers pushes the writer queue can not take. 503 rather than 429, remote write
+// clients retry 5xx by default but not 429.
+func queueFull(c *gin.Context, err error) {
+	c.Header("Retry-After", "1")
+	c.String(http.StatusServiceUnavailable, err.Error())
+}
+
+// pushSamples stamps the samples pushed to route without timestamp, adds global labels and
+// agent_hostname like remoteWrite does, runs them through processors, injects the labels of
+// cred and enqueues them. It fails with writer.ErrQueueFull if the queue is full.
+func pushSamples(route string, cred *pushCredential, samples []*types.Sample, ignoreHostname, ignoreGlobalLabels bool) error {
+	now := time.Now()
+	for _, s := range samples {
+		if s.Timestamp.IsZero() {
+			s.Timestamp = now
+		}
+		// add global labels
+		if !ignoreGlobalLabels {
+			for k, v := range config.GlobalLabels() {
+				if _, has := s.Labels[k]; has {
+					continue
+				}
+				s.Labels[k] = v
+			}
+		}
+		// add label: agent_hostname
+		if _, has := s.Labels[agentHostnameLabelKey]; !has && !ignoreHostname {
+			s.Labels[agentHostnameLabelKey] = config.Config.GetHostname()
+		}
+	}
+
+	// tenant labels are not subject to processors
+	samples = processors.Process(samples)
+	cred.setLabels(samples)
+	return writer.PushSamples(route, samples)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/parser/otlp"
+	"flashcat.cloud/categraf/pkg/limiter"
+	"flashcat.cloud/categraf/types"
+)
+
+// pushCredentialKey keeps the credential authenticated in the gin context
+const pushCredentialKey = "push_credential"
+
+type pushCredential struct {
+	config.PushCredential
+	// nil if not limited
+	requests *limiter.Bucket
+	samples  *limiter.Bucket
+	// totals of the otlp delta series of the credential
+	otlp *otlp.Parser
+}
+
+type pushAuthGroup struct {
+	// empty for all routes
+	routes      map[string]struct{}
+	credentials []*pushCredential
+}
+
+// pushRoutes are the routes push_auth may name
+var pushRoutes = map[string]struct{}{
+	"opentsdb":    {},
+	"openfalcon":  {},
+	"remotewrite": {},
+	"pushgateway": {},
+	"influx":      {},
+	"otlp":        {},
+}
+
+// newPushAuthGroups returns an error on unknown routes, a typo would leave the route open
+func newPushAuthGroups(conf []config.PushAuth) ([]*pushAuthGroup, error) {
+	groups := make([]*pushAuthGroup, 0, len(conf))
+	for _, pa := range conf {
+		g := &pushAuthGroup{routes: make(map[string]struct{}, len(pa.Routes))}
+		for _, route := range pa.Routes {
+			route = strings.ToLower(route)
+			if _, has := pushRoutes[route]; !has {
+				return nil, fmt.Errorf("unknown route %q of push_auth, should be one of opentsdb, openfalcon, remotewrite, pushgateway, influx, otlp", route)
+			}
+			g.routes[route] = struct{}{}
+		}
+		for _, pc := range pa.Credentials {
+			cred := &pushCredential{PushCredential: pc, otlp: otlp.NewParser()}
+			if pc.RequestsPerSecond > 0 {
+				cred.requests = limiter.NewBucket(pc.RequestsPerSecond)
+			}
+			if pc.SamplesPerSecond > 0 {
+				cred.samples = limiter.NewBucket(pc.SamplesPerSecond)
+			}
+			g.credentials = append(g.credentials, cred)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// pushAuthGroupOf returns the first group of push_auth containing route, nil if none
+func pushAuthGroupOf(groups []*pushAuthGroup, route string) *pushAuthGroup {
+	for _, g := range groups {
+		if _, has := g.routes[route]; has || len(g.routes) == 0 {
+			return g
+		}
+	}
+	return nil
+}
+
+// pushAuth authenticates the requests of route by the first group of push_auth containing it,
+// routes not in any group accept anyone
+func pushAuth(groups []*pushAuthGroup, route string) gin.HandlerFunc {
+	group := pushAuthGroupOf(groups, route)
+	if group == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		cred := group.authenticate(c.Request)
+		if cred == nil {
+			c.Header("WWW-Authenticate", `Basic realm="categraf"`)
+			c.String(http.StatusUnauthorized, "unauthorized")
+			c.Abort()
+			return
+		}
+		if !cred.allowRequest() {
+			c.Header("Retry-After", "1")
+			c.String(http.StatusTooManyRequests, "too many requests of %s", cred.Name)
+			c.Abort()
+			return
+		}
+		c.Set(pushCredentialKey, cred)
+		c.Next()
+	}
+}
+
+// allowRequest takes a request from the limit of the credential, nil is not limited
+func (cred *pushCredential) allowRequest() bool {
+	return cred == nil || cred.requests == nil || cred.requests.Allow(1)
+}
+
+// allowSamples takes n samples from the limit of the credential, nil is not limited
+func (cred *pushCredential) allowSamples(n int) bool {
+	return cred == nil || cred.samples == nil || cred.samples.Allow(n)
+}
+
+// setLabels injects the labels of the credential into samples
+func (cred *pushCredential) setLabels(samples []*types.Sample) {
+	if cred == nil {
+		return
+	}
+	for _, s := range samples {
+		for k, v := range cred.Labels {
+			s.Labels[k] = v
+		}
+	}
+}
+
+func equal(given, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(given), []byte(want)) == 1
+}
+
+// bearerToken returns the token of "Bearer xxx", or "Token xxx" sent by influx clients
+func bearerToken(auth string) (string, bool) {
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return token, true
+	}
+	return strings.CutPrefix(auth, "Token ")
+}
+
+// authenticate returns the credential of the bearer token, basic auth or client certificate
+func (g *pushAuthGroup) authenticate(r *http.Request) *pushCredential {
+	if token, ok := bearerToken(r.Header.Get("Authorization")); ok {
+		for _, cred := range g.credentials {
+			if equal(token, cred.Token) {
+				return cred
+			}
+		}
+		return nil
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, cred := range g.credentials {
+			if equal(username, cred.Username) && equal(password, cred.Password) {
+				return cred
+			}
+		}
+		return nil
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, cred := range g.credentials {
+			if equal(cn, cred.CommonName) {
+				return cred
+			}
+		}
+	}
+	return nil
+}
+
+func credentialOf(c *gin.Context) *pushCredential {
+	v, ok := c.Get(pushCredentialKey)
+	if !ok {
+		return nil
+	}
+	return v.(*pushCredential)
+}
+
+// allowSamples takes n samples from the limit of the credential, the request is answered
+// with 429 if it is exceeded
+func allowSamples(c *gin.Context, n int) bool {
+	cred := credentialOf(c)
+	if cred.allowSamples(n) {
+		return true
+	}
+	c.Header("Retry-After", "1")
+	c.String(http.StatusTooManyRequests, "too many samples of %s", cred.Name)
+	return false
+}
+
+// setTenantLabels injects the labels of the credential into series
+func setTenantLabels(c *gin.Context, series []prompb.TimeSeries) {
+	cred := credentialOf(c)
+	if cred == nil || len(cred.Labels) == 0 {
+		return
+	}
+	for i := range series {
+		labels := series[i].Labels[:0]
+		for _, l := range series[i].Labels {
+			if _, has := cred.Labels[l.Name]; !has {
+				labels = append(labels, l)
+			}
+		}
+		for k, v := range cred.Labels {
+			labels = append(labels, prompb.Label{Name: k, Value: v})
+		}
+		// remote write requires labels sorted by name, the series limit hashes them in order
+		sort.Slice(labels, func(a, b int) bool { return labels[a].Name < labels[b].Name })
+		series[i].Labels = labels
+	}
+}
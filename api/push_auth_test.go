@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestPushAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	groups, err := newPushAuthGroups([]config.PushAuth{{
+		Routes: []string{"remotewrite"},
+		Credentials: []config.PushCredential{
+			{Name: "a", Token: "token-a", SamplesPerSecond: 10, Labels: map[string]string{"tenant": "a", "cluster": "x"}},
+			{Name: "b", Username: "b", Password: "secret", RequestsPerSecond: 1},
+			{Name: "c", CommonName: "app.example.com", Labels: map[string]string{"tenant": "c"}},
+		},
+	}})
+	require.NoError(t, err)
+
+	var pushed []prompb.TimeSeries
+	handler := func(c *gin.Context) {
+		series := []prompb.TimeSeries{{Labels: []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "tenant", Value: "spoofed"}, {Name: "zone", Value: "z"}}}}
+		if !allowSamples(c, 8) {
+			return
+		}
+		setTenantLabels(c, series)
+		pushed = series
+		c.String(http.StatusOK, "ok")
+	}
+	r := gin.New()
+	r.POST("/api/push/remotewrite", pushAuth(groups, "remotewrite"), handler)
+	r.POST("/api/push/opentsdb", pushAuth(groups, "opentsdb"), handler)
+
+	do := func(path string, set func(*http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if set != nil {
+			set(req)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do("/api/push/remotewrite", nil))
+	require.Equal(t, http.StatusUnauthorized, do("/api/push/remotewrite", bearer("wrong")))
+	// routes not in any group accept anyone
+	require.Equal(t, http.StatusOK, do("/api/push/opentsdb", nil))
+
+	// tenant labels override those of the client and are sorted with them, samples beyond the limit get 429
+	require.Equal(t, http.StatusOK, do("/api/push/remotewrite", bearer("token-a")))
+	require.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "cluster", Value: "x"}, {Name: "tenant", Value: "a"}, {Name: "zone", Value: "z"}}, pushed[0].Labels)
+	require.Equal(t, http.StatusOK, do("/api/push/remotewrite", bearer("token-a")))
+	require.Equal(t, http.StatusTooManyRequests, do("/api/push/remotewrite", bearer("token-a")))
+
+	// requests beyond the limit get 429
+	basic := func(req *http.Request) { req.SetBasicAuth("b", "secret") }
+	require.Equal(t, http.StatusOK, do("/api/push/remotewrite", basic))
+	require.Equal(t, http.StatusTooManyRequests, do("/api/push/remotewrite", basic))
+	require.Equal(t, http.StatusUnauthorized, do("/api/push/remotewrite", func(req *http.Request) { req.SetBasicAuth("b", "wrong") }))
+
+	// client certificates verified by client_ca_file
+	require.Equal(t, http.StatusOK, do("/api/push/remotewrite", func(req *http.Request) {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "app.example.com"}}}}}
+	}))
+	require.Equal(t, "c", pushed[0].Labels[1].Value)
+	require.Equal(t, http.StatusUnauthorized, do("/api/push/remotewrite", func(req *http.Request) {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "other"}}}}}
+	}))
+}
+
+func TestPushAuthUnknownRoute(t *testing.T) {
+	_, err := newPushAuthGroups([]config.PushAuth{{Routes: []string{"remote_write"}}})
+	require.Error(t, err)
+	_, err = newPushAuthGroups([]config.PushAuth{{Routes: []string{"RemoteWrite", "otlp"}}})
+	require.NoError(t, err)
+}
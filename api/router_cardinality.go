@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/writer"
+)
+
+// cardinality lists the inputs by active series, with the metric names having the most
+// series and the label keys having the most values. ?input=prometheus&top=20
+func cardinality(c *gin.Context) {
+	f, err := filter.NewIncludeExcludeFilter(splitQuery(c.QueryArray("input")), nil)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid top: %s", c.Query("top"))
+		return
+	}
+
+	report, ok := writer.Cardinality(f.Match, top)
+	if !ok {
+		c.String(http.StatusNotFound, "series limit is not configured in [writer_opt]")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
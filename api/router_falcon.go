@@ -14,6 +14,7 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/processors"
 	"flashcat.cloud/categraf/writer"
 )
 
@@ -161,6 +162,10 @@ func openFalcon(c *gin.Context) {
 		return
 	}
 
+	if !allowSamples(c, len(arr)) {
+		return
+	}
+
 	var (
 		fail int
 		succ int
@@ -210,6 +215,12 @@ func openFalcon(c *gin.Context) {
 		log.Println("falcon forwarder error, message:", string(bytes))
 	}
 
-	writer.WriteTimeSeries(series)
+	// tenant labels are not subject to processors
+	series = processors.ProcessSeries(series)
+	setTenantLabels(c, series)
+	if err := writer.PushTimeSeries("openfalcon", series); err != nil {
+		queueFull(c, err)
+		return
+	}
 	c.String(200, "succ:%d fail:%d message:%s", succ, fail, msg)
 }
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/parser/influx"
+	"flashcat.cloud/categraf/types"
+)
+
+// influxPrecision maps the precision param of influx v1 and v2 writes, nanosecond by default
+func influxPrecision(p string) (lineprotocol.Precision, error) {
+	switch p {
+	case "", "n", "ns":
+		return lineprotocol.Nanosecond, nil
+	case "u", "us":
+		return lineprotocol.Microsecond, nil
+	case "ms":
+		return lineprotocol.Millisecond, nil
+	case "s":
+		return lineprotocol.Second, nil
+	}
+	return 0, fmt.Errorf("unsupported precision: %s", p)
+}
+
+// influxError answers in the format of influxdb, understood by both v1 and v2 clients
+func influxError(c *gin.Context, code int, msg string) {
+	c.JSON(code, gin.H{"code": "invalid", "message": msg, "error": msg})
+}
+
+// influxWrite accepts influx line protocol on /api/push/influx and the compatible paths /write
+// and /api/v2/write. A field of a line is a sample named measurement_field.
+func influxWrite(c *gin.Context) {
+	precision, err := influxPrecision(c.Query("precision"))
+	if err != nil {
+		influxError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bs, err := readerGzipBody(c.GetHeader("Content-Encoding"), c.Request)
+	if err != nil {
+		influxError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	slist := types.NewSampleList()
+	fails, err := influx.NewParserWithTime(precision).ParseLines(bs, slist)
+	samples := slist.PopBackAll()
+	count := len(samples)
+	if count == 0 {
+		msg := "no valid samples"
+		if err != nil {
+			msg = err.Error()
+		}
+		influxError(c, http.StatusBadRequest, msg)
+		return
+	}
+	if !allowSamples(c, count) {
+		return
+	}
+
+	if dbLabel := config.Config.HTTP.InfluxDBLabel; dbLabel != "" {
+		db := c.Query("db")
+		if db == "" {
+			db = c.Query("bucket")
+		}
+		if db != "" {
+			for _, s := range samples {
+				s.Labels[dbLabel] = db
+			}
+		}
+	}
+
+	ignoreHostname := config.Config.HTTP.IgnoreHostname || QueryBoolWithValues("ignore_hostname")(c)
+	ignoreGlobalLabels := config.Config.HTTP.IgnoreGlobalLabels || QueryBoolWithValues("ignore_global_labels")(c)
+	if err := pushSamples("influx", credentialOf(c), samples, ignoreHostname, ignoreGlobalLabels); err != nil {
+		c.Header("Retry-After", "1")
+		influxError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	if fails > 0 {
+		log.Println("W! influx write:", fails, "lines failed to parse, first error:", err)
+		influxError(c, http.StatusBadRequest, fmt.Sprintf("partial write: %d lines failed to parse: %v", fails, err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestInfluxWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// samples are printed in test mode
+	config.Config = &config.ConfigType{HTTP: &config.HTTP{InfluxDBLabel: "db"}, TestMode: true}
+	if config.HostInfo == nil {
+		config.HostInfo = &config.HostInfoCache{}
+	}
+	r := gin.New()
+	r.POST("/write", influxWrite)
+	r.POST("/api/v2/write", influxWrite)
+
+	do := func(path string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusNoContent, do("/write?db=app&precision=s", []byte("cpu,host=a usage=1 1700000000\n"), false).Code)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte("cpu,host=a usage=1 1700000000000\n"))
+	require.NoError(t, zw.Close())
+	require.Equal(t, http.StatusNoContent, do("/api/v2/write?bucket=app&precision=ms", buf.Bytes(), true).Code)
+
+	w := do("/write", []byte("cpu,host=a usage=1\nbroken\n"), false)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "partial write: 1 lines")
+
+	require.Equal(t, http.StatusBadRequest, do("/write", []byte("broken\n"), false).Code)
+	require.Equal(t, http.StatusBadRequest, do("/write?precision=h", []byte("cpu usage=1\n"), false).Code)
+}
@@ -0,0 +1,16 @@
+//go:build !no_logs
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/logs/status"
+)
+
+// logsStatus shows the sources and tailers of logs agent
+func logsStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, status.Get())
+}
@@ -0,0 +1,13 @@
+//go:build no_logs
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func logsStatus(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"error": "logs agent is not built in"})
+}
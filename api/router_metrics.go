@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/expfmt"
+
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/writer"
+)
+
+// metrics serves the latest value of every series gathered by inputs, the inputs
+// may be selected with ?input=cpu&input=net* and ?exclude_input=...
+func metrics(c *gin.Context) {
+	include := splitQuery(c.QueryArray("input"))
+	exclude := splitQuery(c.QueryArray("exclude_input"))
+	f, err := filter.NewIncludeExcludeFilter(include, exclude)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	families := writer.GatherExposed(f.Match)
+
+	format := expfmt.NegotiateIncludingOpenMetrics(c.Request.Header)
+	c.Header("Content-Type", string(format))
+	c.Status(http.StatusOK)
+
+	enc := expfmt.NewEncoder(c.Writer, format)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		closer.Close()
+	}
+}
+
+// splitQuery accepts both repeated parameters and comma separated values
+func splitQuery(vs []string) []string {
+	ret := make([]string, 0, len(vs))
+	for _, v := range vs {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				ret = append(ret, s)
+			}
+		}
+	}
+	return ret
+}
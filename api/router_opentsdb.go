@@ -14,6 +14,7 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/processors"
 	"flashcat.cloud/categraf/writer"
 )
 
@@ -143,6 +144,10 @@ func openTSDB(c *gin.Context) {
 		return
 	}
 
+	if !allowSamples(c, len(list)) {
+		return
+	}
+
 	var (
 		fail int
 		succ int
@@ -195,6 +200,12 @@ func openTSDB(c *gin.Context) {
 		log.Println("opentsdb forwarder error, message:", string(bytes))
 	}
 
-	writer.WriteTimeSeries(series)
+	// tenant labels are not subject to processors
+	series = processors.ProcessSeries(series)
+	setTenantLabels(c, series)
+	if err := writer.PushTimeSeries("opentsdb", series); err != nil {
+		queueFull(c, err)
+		return
+	}
 	c.String(200, "succ:%d fail:%d message:%s", succ, fail, msg)
 }
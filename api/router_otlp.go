@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/parser/otlp"
+	"flashcat.cloud/categraf/types"
+)
+
+// otlpParser keeps the totals of delta series pushed without credentials, over http or grpc.
+// Every credential of push_auth has its own.
+var otlpParser = otlp.NewParser()
+
+func otlpParserOf(cred *pushCredential) *otlp.Parser {
+	if cred == nil {
+		return otlpParser
+	}
+	return cred.otlp
+}
+
+const otlpJSON = "application/json"
+
+// otlpMetrics accepts OTLP/HTTP metrics on /v1/metrics, in protobuf or json
+func otlpMetrics(c *gin.Context) {
+	isJSON := strings.HasPrefix(c.ContentType(), otlpJSON)
+	bs, err := readerGzipBody(c.GetHeader("Content-Encoding"), c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	if isJSON {
+		err = protojson.Unmarshal(bs, req)
+	} else {
+		err = proto.Unmarshal(bs, req)
+	}
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cred := credentialOf(c)
+	parser := otlpParserOf(cred)
+	batch := parser.Parse(req.GetResourceMetrics())
+	if len(batch.Samples) > 0 {
+		if !allowSamples(c, len(batch.Samples)) {
+			return
+		}
+		ignoreHostname := config.Config.HTTP.IgnoreHostname || QueryBoolWithValues("ignore_hostname")(c)
+		ignoreGlobalLabels := config.Config.HTTP.IgnoreGlobalLabels || QueryBoolWithValues("ignore_global_labels")(c)
+		err := parser.Push(batch, func(samples []*types.Sample) error {
+			return pushSamples("otlp", cred, samples, ignoreHostname, ignoreGlobalLabels)
+		})
+		if err != nil {
+			queueFull(c, err)
+			return
+		}
+	}
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if isJSON {
+		bs, err = protojson.Marshal(resp)
+	} else {
+		bs, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if isJSON {
+		c.Data(http.StatusOK, otlpJSON, bs)
+	} else {
+		c.Data(http.StatusOK, "application/x-protobuf", bs)
+	}
+}
+
+// otlpServer is the OTLP gRPC metrics service, authenticated by the push_auth group of otlp
+type otlpServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	auth *pushAuthGroup
+}
+
+func (s *otlpServer) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	var cred *pushCredential
+	if s.auth != nil {
+		cred = s.auth.authenticate(grpcRequest(ctx))
+		if cred == nil {
+			return nil, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		if !cred.allowRequest() {
+			return nil, status.Errorf(codes.ResourceExhausted, "too many requests of %s", cred.Name)
+		}
+	}
+
+	parser := otlpParserOf(cred)
+	batch := parser.Parse(req.GetResourceMetrics())
+	if len(batch.Samples) > 0 {
+		if !cred.allowSamples(len(batch.Samples)) {
+			return nil, status.Errorf(codes.ResourceExhausted, "too many samples of %s", cred.Name)
+		}
+		err := parser.Push(batch, func(samples []*types.Sample) error {
+			return pushSamples("otlp", cred, samples, config.Config.HTTP.IgnoreHostname, config.Config.HTTP.IgnoreGlobalLabels)
+		})
+		if err != nil {
+			// retryable for OTLP exporters
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+// grpcRequest builds a request of the metadata and peer certificates of ctx for authentication
+func grpcRequest(ctx context.Context) *http.Request {
+	r := &http.Request{Header: make(http.Header)}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			r.Header.Add("Authorization", v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r
+}
+
+// startOTLPGRPC serves OTLP metrics over gRPC on otlp_grpc_address, with TLS if cert_file and key_file are set
+func startOTLPGRPC(conf *config.HTTP, groups []*pushAuthGroup) {
+	addr := config.Expand(conf.OTLPGRPCAddress)
+	if addr == "" {
+		return
+	}
+
+	var opts []grpc.ServerOption
+	if conf.CertFile != "" && conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			log.Println("E! failed to load cert_file and key_file of otlp grpc:", err)
+			return
+		}
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+		if conf.ClientCAFile != "" {
+			pool, err := loadCertPool(conf.ClientCAFile)
+			if err != nil {
+				log.Println("E! failed to load client_ca_file of otlp grpc:", err)
+				return
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Println("E! failed to listen otlp grpc:", err)
+		return
+	}
+	srv := grpc.NewServer(opts...)
+	colmetricspb.RegisterMetricsServiceServer(srv, &otlpServer{auth: pushAuthGroupOf(groups, "otlp")})
+
+	log.Println("I! otlp grpc server listening on:", addr)
+	if err := srv.Serve(lis); err != nil {
+		log.Println("E! otlp grpc server stopped:", err)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// samples are printed in test mode
+	config.Config = &config.ConfigType{HTTP: &config.HTTP{}, TestMode: true}
+	if config.HostInfo == nil {
+		config.HostInfo = &config.HostInfoCache{}
+	}
+	r := gin.New()
+	r.POST("/v1/metrics", otlpMetrics)
+
+	do := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	body, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "up",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}},
+			}}},
+		}}}},
+	}}})
+	require.NoError(t, err)
+	w := do("application/x-protobuf", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/x-protobuf", w.Header().Get("Content-Type"))
+
+	json := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"up","gauge":{"dataPoints":[{"asDouble":1}]}}]}]}]}`
+	w = do("application/json", []byte(json))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "{}", w.Body.String())
+
+	require.Equal(t, http.StatusBadRequest, do("application/json", []byte("{broken")).Code)
+}
+
+func TestOTLPDeltaRetry(t *testing.T) {
+	config.Config = &config.ConfigType{HTTP: &config.HTTP{}, TestMode: true}
+	if config.HostInfo == nil {
+		config.HostInfo = &config.HostInfoCache{}
+	}
+	groups, err := newPushAuthGroups([]config.PushAuth{{
+		Routes:      []string{"otlp"},
+		Credentials: []config.PushCredential{{Name: "a", Token: "token-a", SamplesPerSecond: 2}},
+	}})
+	require.NoError(t, err)
+	srv := &otlpServer{auth: pushAuthGroupOf(groups, "otlp")}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token-a"))
+
+	export := func(m *metricspb.Metric) error {
+		_, err := srv.Export(ctx, &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{m}}},
+		}}})
+		return err
+	}
+	delta := &metricspb.Metric{
+		Name: "requests",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            true,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints:             []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}}},
+		}},
+	}
+	gauge := &metricspb.Metric{
+		Name: "up",
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+			{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}},
+		}}},
+	}
+
+	require.NoError(t, export(delta))
+	require.NoError(t, export(gauge))
+	// the samples limit is used up, the delta is rejected and retried by the client
+	require.Equal(t, codes.ResourceExhausted, status.Code(export(delta)))
+	require.Eventually(t, func() bool { return export(delta) == nil }, 5*time.Second, 50*time.Millisecond)
+
+	var total float64
+	cred := groups[0].credentials[0]
+	require.NoError(t, cred.otlp.Push(cred.otlp.Parse([]*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{delta}}},
+	}}), func(samples []*types.Sample) error {
+		total = samples[0].Value.(float64)
+		return nil
+	}))
+	require.Equal(t, 9.0, total)
+	// anonymous clients do not share the totals of credentials
+	require.NotSame(t, otlpParser, cred.otlp)
+}
@@ -12,6 +12,7 @@ import (
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/parser/prometheus"
+	"flashcat.cloud/categraf/processors"
 	"flashcat.cloud/categraf/types"
 	"flashcat.cloud/categraf/writer"
 )
@@ -67,6 +68,9 @@ func pushgateway(c *gin.Context) {
 		c.String(http.StatusBadRequest, "no valid samples")
 		return
 	}
+	if !allowSamples(c, count) {
+		return
+	}
 
 	ignoreHostname := config.Config.HTTP.IgnoreHostname || QueryBoolWithValues("ignore_hostname")(c)
 	ignoreGlobalLabels := config.Config.HTTP.IgnoreGlobalLabels || QueryBoolWithValues("ignore_global_labels")(c)
@@ -114,7 +118,13 @@ func pushgateway(c *gin.Context) {
 			}
 		}
 	}
-	writer.WriteSamples(samples)
+	// tenant labels are not subject to processors
+	samples = processors.Process(samples)
+	credentialOf(c).setLabels(samples)
+	if err := writer.PushSamples("pushgateway", samples); err != nil {
+		queueFull(c, err)
+		return
+	}
 	c.String(http.StatusOK, "forwarding...")
 }
 
@@ -7,6 +7,7 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/processors"
 	"flashcat.cloud/categraf/writer"
 )
 
@@ -22,6 +23,9 @@ func remoteWrite(c *gin.Context) {
 		c.String(http.StatusBadRequest, "payload empty")
 		return
 	}
+	if !allowSamples(c, count) {
+		return
+	}
 
 	ignoreHostname := config.Config.HTTP.IgnoreHostname || QueryBoolWithValues("ignore_hostname")(c)
 	ignoreGlobalLabels := config.Config.HTTP.IgnoreGlobalLabels || QueryBoolWithValues("ignore_global_labels")(c)
@@ -50,7 +54,13 @@ func remoteWrite(c *gin.Context) {
 		}
 	}
 
-	writer.WriteTimeSeries(req.Timeseries)
+	// tenant labels are not subject to processors
+	req.Timeseries = processors.ProcessSeries(req.Timeseries)
+	setTenantLabels(c, req.Timeseries)
+	if err := writer.PushTimeSeries("remotewrite", req.Timeseries); err != nil {
+		queueFull(c, err)
+		return
+	}
 	c.String(200, "forwarding...")
 }
 
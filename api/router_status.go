@@ -0,0 +1,84 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/agent"
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/writer"
+)
+
+// inputsStatus lists the running inputs with their instances and last gather,
+// the inputs may be selected with ?input=mysql&input=redis*
+func inputsStatus(c *gin.Context) {
+	f, err := filter.NewIncludeExcludeFilter(splitQuery(c.QueryArray("input")), nil)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	statuses, err := agent.InputStatuses()
+	if err != nil {
+		c.String(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	ret := statuses[:0]
+	for _, st := range statuses {
+		if f.Match(st.Name) {
+			ret = append(ret, st)
+		}
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+func writersStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, writer.QueueMetrics())
+}
+
+// controlAuth checks the bearer token of control requests
+func controlAuth(c *gin.Context) {
+	token := config.Config.HTTP.APIToken
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "control api is disabled, set api_token in [http]"})
+		return
+	}
+	auth := c.GetHeader("Authorization")
+	given, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	c.Next()
+}
+
+func controlError(c *gin.Context, err error) {
+	if errors.Is(err, agent.ErrMetricsAgentNotRunning) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+}
+
+func reloadInput(c *gin.Context) {
+	name := c.Param("name")
+	if err := agent.ReloadInput(name); err != nil {
+		controlError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"input": name, "reloaded": true})
+}
+
+func gatherInput(c *gin.Context) {
+	name := c.Param("name")
+	triggered, err := agent.GatherInput(name)
+	if err != nil {
+		controlError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"input": name, "triggered": triggered})
+}
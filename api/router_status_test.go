@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestControlAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Config = &config.ConfigType{HTTP: &config.HTTP{}}
+	r := gin.New()
+	r.POST("/api/v1/inputs/:name/gather", controlAuth, gatherInput)
+
+	do := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/inputs/mysql/gather", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusForbidden, do("Bearer secret").Code)
+
+	config.Config.HTTP.APIToken = "secret"
+	require.Equal(t, http.StatusUnauthorized, do("").Code)
+	require.Equal(t, http.StatusUnauthorized, do("Bearer wrong").Code)
+	require.Equal(t, http.StatusUnauthorized, do("secret").Code)
+	// authorized, but there is no metrics agent
+	require.Equal(t, http.StatusServiceUnavailable, do("Bearer secret").Code)
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -39,7 +42,16 @@ func Start() {
 		r.Use(aop.Logger())
 	}
 
-	configRoutes(r)
+	auth, err := newPushAuthGroups(conf.PushAuth)
+	if err != nil {
+		log.Println("E! failed to start http server:", err)
+		return
+	}
+	if conf.ClientCAFile != "" && (conf.CertFile == "" || conf.KeyFile == "") {
+		log.Println("W! client_ca_file is ignored without cert_file and key_file, client certificates are not verified")
+	}
+	configRoutes(r, auth)
+	go startOTLPGRPC(conf, auth)
 
 	addr := config.Expand(conf.Address)
 	srv := &http.Server{
@@ -52,9 +64,18 @@ func Start() {
 
 	log.Println("I! http server listening on:", addr)
 
-	var err error
 	if conf.CertFile != "" && conf.KeyFile != "" {
 		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if conf.ClientCAFile != "" {
+			pool, err := loadCertPool(conf.ClientCAFile)
+			if err != nil {
+				log.Println("E! failed to load client_ca_file:", err)
+				return
+			}
+			// clients without certificate may still use tokens
+			srv.TLSConfig.ClientCAs = pool
+			srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
 		err = srv.ListenAndServeTLS(conf.CertFile, conf.KeyFile)
 	} else {
 		err = srv.ListenAndServe()
@@ -65,20 +86,54 @@ func Start() {
 	}
 }
 
-func configRoutes(r *gin.Engine) {
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+func configRoutes(r *gin.Engine, auth []*pushAuthGroup) {
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(200, "pong")
 	})
 
+	if config.Config.HTTP.ExposeMetrics {
+		r.GET("/metrics", metrics)
+	}
+	r.GET("/debug/cardinality", cardinality)
+
+	v1 := r.Group("/api/v1")
+	v1.GET("/inputs", inputsStatus)
+	v1.GET("/writers", writersStatus)
+	v1.GET("/logs/status", logsStatus)
+	v1.POST("/inputs/:name/reload", controlAuth, reloadInput)
+	v1.POST("/inputs/:name/gather", controlAuth, gatherInput)
+
 	g := r.Group("/api/push")
-	g.POST("/opentsdb", openTSDB)
-	g.POST("/openfalcon", openFalcon)
-	g.POST("/remotewrite", remoteWrite)
+	g.POST("/opentsdb", pushAuth(auth, "opentsdb"), openTSDB)
+	g.POST("/openfalcon", pushAuth(auth, "openfalcon"), openFalcon)
+	g.POST("/remotewrite", pushAuth(auth, "remotewrite"), remoteWrite)
+
+	// influx line protocol, and the write paths of influxdb v1 and v2
+	influxAuth := pushAuth(auth, "influx")
+	g.POST("/influx", influxAuth, influxWrite)
+	r.POST("/write", influxAuth, influxWrite)
+	r.POST("/api/v2/write", influxAuth, influxWrite)
+
+	// OTLP/HTTP
+	r.POST("/v1/metrics", pushAuth(auth, "otlp"), otlpMetrics)
 
 	// pushgateway
-	g.POST("/pushgateway", pushgateway)
-	g.PUT("/pushgateway/metrics/:jobtype/:job", pushgateway)
-	g.POST("/pushgateway/metrics/:jobtype/:job", pushgateway)
-	g.PUT("/pushgateway/metrics/:jobtype/:job/*labels", pushgateway)
-	g.POST("/pushgateway/metrics/:jobtype/:job/*labels", pushgateway)
+	pg := pushAuth(auth, "pushgateway")
+	g.POST("/pushgateway", pg, pushgateway)
+	g.PUT("/pushgateway/metrics/:jobtype/:job", pg, pushgateway)
+	g.POST("/pushgateway/metrics/:jobtype/:job", pg, pushgateway)
+	g.PUT("/pushgateway/metrics/:jobtype/:job/*labels", pg, pushgateway)
+	g.POST("/pushgateway/metrics/:jobtype/:job/*labels", pg, pushgateway)
 }
@@ -20,6 +20,9 @@ import (
 
 const (
 	defaultProbeAddr = "223.5.5.5:80"
+
+	// max_retries of writers when disk buffer is enabled and it is not set
+	defaultBufferRetries = 3
 )
 
 var envVarEscaper = strings.NewReplacer(
@@ -36,6 +39,13 @@ type Global struct {
 	Interval     Duration          `toml:"interval"`
 	Providers    []string          `toml:"providers"`
 	Concurrency  int               `toml:"concurrency"`
+	// each gather waits a random time up to collection_jitter, gathers are aligned to
+	// the interval boundaries if round_interval
+	CollectionJitter Duration `toml:"collection_jitter"`
+	RoundInterval    bool     `toml:"round_interval"`
+	// samples gathered without timestamp are stamped with the scheduled time of the gather
+	// instead of the time they are processed
+	TickTimestamp bool `toml:"tick_timestamp"`
 }
 
 type Log struct {
@@ -50,21 +60,144 @@ type Log struct {
 type WriterOpt struct {
 	Batch    int `toml:"batch"`
 	ChanSize int `toml:"chan_size"`
+	// the first batch after the queue was idle waits a random time up to flush_jitter
+	FlushJitter Duration `toml:"flush_jitter"`
+
+	DiskBuffer *DiskBuffer `toml:"disk_buffer"`
+
+	// unique series limits, new series beyond them are dropped; 0 means no limit
+	MaxSeries         int            `toml:"max_series"`
+	MaxSeriesPerInput int            `toml:"max_series_per_input"`
+	SeriesLimits      map[string]int `toml:"series_limits"`
+	// a series not written within series_expire does not count anymore
+	SeriesExpire Duration `toml:"series_expire"`
+}
+
+// DiskBuffer spills batches that failed to send or overflowed the queue to disk
+type DiskBuffer struct {
+	Enable         bool     `toml:"enable"`
+	Path           string   `toml:"path"`
+	MaxBytes       int64    `toml:"max_bytes"`
+	MaxAge         Duration `toml:"max_age"`
+	SegmentBytes   int64    `toml:"segment_bytes"`
+	ReplayInterval Duration `toml:"replay_interval"`
 }
 
 type WriterOption struct {
+	// writer type: prometheus(default) / influxdb / opentsdb / kafka / file
+	Type string `toml:"type"`
+	// output format, kafka: json / protobuf, file: json / influx
+	Format string `toml:"format"`
+
 	Url           string   `toml:"url"`
 	BasicAuthUser string   `toml:"basic_auth_user"`
 	BasicAuthPass string   `toml:"basic_auth_pass"`
 	Headers       []string `toml:"headers"`
 
+	// prometheus writer: remote write protocol version, 1.0(default) / 2.0
+	RemoteWriteVersion string `toml:"remote_write_version"`
+
 	Timeout             int64 `toml:"timeout"`
 	DialTimeout         int64 `toml:"dial_timeout"`
 	MaxIdleConnsPerHost int   `toml:"max_idle_conns_per_host"`
 
+	// batches waiting for this writer, and goroutines sending them
+	QueueSize   int `toml:"queue_size"`
+	Concurrency int `toml:"concurrency"`
+
+	// retry on network error, 429 and 5xx; 0 means retry until delivered,
+	// or 3 times before spilling if disk buffer is enabled
+	MaxRetries int `toml:"max_retries"`
+	// retry backoff settings, unit: ms
+	RetryBackoffBase int64 `toml:"retry_backoff_base"`
+	RetryBackoffMax  int64 `toml:"retry_backoff_max"`
+
+	// kafka writer
+	Brokers       []string `toml:"brokers"`
+	Topic         string   `toml:"topic"`
+	KafkaVersion  string   `toml:"kafka_version"`
+	SaslEnable    bool     `toml:"sasl_enable"`
+	SaslMechanism string   `toml:"sasl_mechanism"`
+	SaslUser      string   `toml:"sasl_user"`
+	SaslPassword  string   `toml:"sasl_password"`
+
+	// file writer, stdout and stderr are supported
+	Path string `toml:"path"`
+
 	tls.ClientConfig
 }
 
+// Name identifies a writer in logs and metrics
+func (w WriterOption) Name() string {
+	switch w.Type {
+	case "kafka":
+		return "kafka://" + strings.Join(w.Brokers, ",") + "/" + w.Topic
+	case "file":
+		return "file://" + w.Path
+	}
+	return w.Url
+}
+
+// ProcessorOption configures one processor of the global chain, the fields
+// used depend on Type
+type ProcessorOption struct {
+	// processor type: rename / regex / scale / rate / delta / cardinality
+	Type string `toml:"type"`
+	// metric names the processor applies to, support glob, empty means all
+	Metrics []string `toml:"metrics"`
+
+	// rename
+	MetricRenames map[string]string `toml:"metric_renames"`
+	LabelRenames  map[string]string `toml:"label_renames"`
+
+	// regex: rewrite the value of label(__name__ for metric name) matching regex to replacement
+	Label       string `toml:"label"`
+	Regex       string `toml:"regex"`
+	Replacement string `toml:"replacement"`
+	TargetLabel string `toml:"target_label"`
+
+	// scale: value * factor + offset, or convert from_unit to to_unit
+	Factor   float64 `toml:"factor"`
+	Offset   float64 `toml:"offset"`
+	FromUnit string  `toml:"from_unit"`
+	ToUnit   string  `toml:"to_unit"`
+
+	// rate / delta: the result is renamed with suffix, the counter itself is dropped unless keep_original
+	Suffix       string `toml:"suffix"`
+	KeepOriginal bool   `toml:"keep_original"`
+
+	// cardinality: distinct values kept per label of a metric, the rest are replaced with overflow_value
+	// or dropped if drop is true; values not seen within expire are forgotten
+	Labels        []string `toml:"labels"`
+	Limit         int      `toml:"limit"`
+	OverflowValue string   `toml:"overflow_value"`
+	Drop          bool     `toml:"drop"`
+	Expire        Duration `toml:"expire"`
+}
+
+// AggregatorOption configures an aggregator, samples matching metrics are rolled
+// up over period and the results are written at the end of each period
+type AggregatorOption struct {
+	// aggregator type: basicstats / histogram
+	Type string `toml:"type"`
+	// metric names to aggregate, support glob
+	Metrics []string `toml:"metrics"`
+	Period  Duration `toml:"period"`
+	// do not write the samples being aggregated
+	DropOriginal bool `toml:"drop_original"`
+
+	// basicstats: min / max / mean / count / sum, and quantiles between 0 and 1
+	Stats     []string  `toml:"stats"`
+	Quantiles []float64 `toml:"quantiles"`
+
+	// histogram: upper bounds of buckets
+	Buckets []float64 `toml:"buckets"`
+	// histogram: counts start from zero every period, emitted as gauges. they are cumulative otherwise
+	Reset bool `toml:"reset"`
+	// histogram: cumulative series not updated within expire are forgotten, 10m by default
+	Expire Duration `toml:"expire"`
+}
+
 type HTTP struct {
 	Enable         bool   `toml:"enable"`
 	Address        string `toml:"address"`
@@ -79,6 +212,47 @@ type HTTP struct {
 	ReadTimeout        int    `toml:"read_timeout"`
 	WriteTimeout       int    `toml:"write_timeout"`
 	IdleTimeout        int    `toml:"idle_timeout"`
+
+	// serve the latest value of every gathered series on /metrics
+	ExposeMetrics bool `toml:"expose_metrics"`
+	// a series not gathered again within this many input intervals is not exposed anymore
+	ExposeStaleIntervals int `toml:"expose_stale_intervals"`
+
+	// bearer token of the control api: reload or gather an input. control api is disabled if empty
+	APIToken string `toml:"api_token"`
+
+	// client certificates signed by these CAs are verified, push_auth may accept them by common name
+	ClientCAFile string `toml:"client_ca_file"`
+	// authentication of the push routes, routes not in any group accept anyone
+	PushAuth []PushAuth `toml:"push_auth"`
+
+	// label of the db (v1) or bucket (v2) param of influx writes, ignored if empty
+	InfluxDBLabel string `toml:"influx_db_label"`
+
+	// address of the OTLP gRPC receiver, disabled if empty. OTLP over http is on /v1/metrics
+	OTLPGRPCAddress string `toml:"otlp_grpc_address"`
+}
+
+// PushAuth is the authentication of a group of push routes
+type PushAuth struct {
+	// opentsdb, openfalcon, remotewrite, pushgateway, influx, otlp; empty for all of them
+	Routes      []string         `toml:"routes"`
+	Credentials []PushCredential `toml:"credentials"`
+}
+
+// PushCredential is a client of the push routes, identified by a bearer token, basic auth
+// or the common name of its client certificate
+type PushCredential struct {
+	Name       string `toml:"name"`
+	Token      string `toml:"token"`
+	Username   string `toml:"username"`
+	Password   string `toml:"password"`
+	CommonName string `toml:"common_name"`
+	// 0 means no limit
+	RequestsPerSecond float64 `toml:"requests_per_second"`
+	SamplesPerSecond  float64 `toml:"samples_per_second"`
+	// injected into every sample pushed, overriding those of the client
+	Labels map[string]string `toml:"labels"`
 }
 
 type IbexConfig struct {
@@ -112,17 +286,22 @@ type ConfigType struct {
 	InputFilters string
 
 	// from config.toml
-	Global     Global           `toml:"global"`
-	WriterOpt  WriterOpt        `toml:"writer_opt"`
-	Writers    []WriterOption   `toml:"writers"`
-	Logs       Logs             `toml:"logs"`
-	HTTP       *HTTP            `toml:"http"`
-	Prometheus *Prometheus      `toml:"prometheus"`
-	Ibex       *IbexConfig      `toml:"ibex"`
-	Heartbeat  *HeartbeatConfig `toml:"heartbeat"`
-	Log        Log              `toml:"log"`
-
-	HTTPProviderConfig *HTTPProviderConfig `toml:"http_provider"`
+	Global      Global             `toml:"global"`
+	WriterOpt   WriterOpt          `toml:"writer_opt"`
+	Writers     []WriterOption     `toml:"writers"`
+	Processors  []ProcessorOption  `toml:"processors"`
+	Aggregators []AggregatorOption `toml:"aggregators"`
+	Logs        Logs               `toml:"logs"`
+	HTTP        *HTTP              `toml:"http"`
+	Prometheus  *Prometheus        `toml:"prometheus"`
+	Ibex        *IbexConfig        `toml:"ibex"`
+	Heartbeat   *HeartbeatConfig   `toml:"heartbeat"`
+	Log         Log                `toml:"log"`
+
+	HTTPProviderConfig  *HTTPProviderConfig  `toml:"http_provider"`
+	LocalProviderConfig *LocalProviderConfig `toml:"local_provider"`
+	ConsulProvider      *KVProviderConfig    `toml:"consul_provider"`
+	EtcdProvider        *KVProviderConfig    `toml:"etcd_provider"`
 }
 
 var Config *ConfigType
@@ -161,6 +340,52 @@ func InitConfig(configDir string, debugLevel int, debugMode, testMode bool, inte
 		Config.WriterOpt.Batch = 1000
 	}
 
+	for i := range Config.Writers {
+		w := &Config.Writers[i]
+		if w.QueueSize <= 0 {
+			w.QueueSize = Config.WriterOpt.ChanSize/Config.WriterOpt.Batch + 1
+		}
+		if w.Concurrency <= 0 {
+			w.Concurrency = 1
+		}
+		if w.RetryBackoffBase <= 0 {
+			w.RetryBackoffBase = 500
+		}
+		if w.RetryBackoffMax <= 0 {
+			w.RetryBackoffMax = 30000
+		}
+		// a batch retried forever in memory would never reach the disk buffer
+		if w.MaxRetries <= 0 && Config.WriterOpt.DiskBuffer != nil && Config.WriterOpt.DiskBuffer.Enable {
+			w.MaxRetries = defaultBufferRetries
+		}
+	}
+
+	if Config.WriterOpt.SeriesExpire <= 0 {
+		Config.WriterOpt.SeriesExpire = Duration(30 * time.Minute)
+	}
+
+	if db := Config.WriterOpt.DiskBuffer; db != nil && db.Enable {
+		if db.Path == "" {
+			db.Path = "./data/writer"
+		}
+		if db.MaxBytes <= 0 {
+			db.MaxBytes = 1024 * 1024 * 1024
+		}
+		if db.ReplayInterval <= 0 {
+			db.ReplayInterval = Duration(5 * time.Second)
+		}
+	}
+
+	for i := range Config.Aggregators {
+		if Config.Aggregators[i].Period <= 0 {
+			Config.Aggregators[i].Period = Duration(30 * time.Second)
+		}
+	}
+
+	if Config.HTTP != nil && Config.HTTP.ExposeStaleIntervals <= 0 {
+		Config.HTTP.ExposeStaleIntervals = 2
+	}
+
 	Config.Global.Hostname = strings.TrimSpace(Config.Global.Hostname)
 
 	if err := InitHostInfo(); err != nil {
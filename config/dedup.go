@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/types"
+)
+
+const defaultDedupHeartbeat = 5 * time.Minute
+
+type emission struct {
+	value string
+	sent  time.Time
+	seen  time.Time
+}
+
+// dedupCache remembers the last emitted value of every series of an input
+type dedupCache struct {
+	sync.Mutex
+	heartbeat time.Duration
+	last      map[string]*emission
+	lastPurge time.Time
+}
+
+func newDedupCache(heartbeat time.Duration) *dedupCache {
+	if heartbeat <= 0 {
+		heartbeat = defaultDedupHeartbeat
+	}
+	return &dedupCache{
+		heartbeat: heartbeat,
+		last:      make(map[string]*emission),
+		lastPurge: time.Now(),
+	}
+}
+
+// emit reports whether s should be sent: its value changed since the last emission,
+// or the last emission is older than heartbeat
+func (dc *dedupCache) emit(s *types.Sample, now time.Time) bool {
+	key := s.SeriesKey()
+	value := fmt.Sprint(s.Value)
+
+	dc.Lock()
+	defer dc.Unlock()
+	dc.purge(now)
+
+	e, has := dc.last[key]
+	if has && e.value == value && now.Sub(e.sent) < dc.heartbeat {
+		e.seen = now
+		return false
+	}
+	dc.last[key] = &emission{value: value, sent: now, seen: now}
+	return true
+}
+
+// purge forgets series not gathered for two heartbeats
+func (dc *dedupCache) purge(now time.Time) {
+	if now.Sub(dc.lastPurge) < dc.heartbeat {
+		return
+	}
+	for k, e := range dc.last {
+		if now.Sub(e.seen) > 2*dc.heartbeat {
+			delete(dc.last, k)
+		}
+	}
+	dc.lastPurge = now
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestDedupCache(t *testing.T) {
+	dc := newDedupCache(time.Minute)
+	now := time.Now()
+	sample := func(v interface{}) *types.Sample {
+		return types.NewSample("", "systemd_unit_state", v, map[string]string{"unit": "sshd"})
+	}
+
+	require.True(t, dc.emit(sample(1), now))
+	require.False(t, dc.emit(sample(1), now.Add(10*time.Second)))
+	require.True(t, dc.emit(sample(0), now.Add(20*time.Second)))
+	require.False(t, dc.emit(sample(0), now.Add(30*time.Second)))
+	// heartbeat
+	require.True(t, dc.emit(sample(0), now.Add(90*time.Second)))
+}
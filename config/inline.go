@@ -6,6 +6,8 @@ import (
 
 	"github.com/prometheus/common/model"
 
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/derive"
 	"flashcat.cloud/categraf/pkg/filter"
 	modelLabel "flashcat.cloud/categraf/pkg/prom/labels"
 	"flashcat.cloud/categraf/pkg/relabel"
@@ -42,6 +44,22 @@ type InternalConfig struct {
 	RelabelConfigs []*RelabelConfig  `toml:"relabel_configs"`
 	relabelConfigs []*relabel.Config `toml:"-"`
 
+	// counters replaced with their per-second rate or increase since the last gather,
+	// named with the suffix, _rate and _delta by default; support glob on final metric names
+	RateMetrics        []string `toml:"rate_metrics"`
+	DeltaMetrics       []string `toml:"delta_metrics"`
+	RateSuffix         string   `toml:"rate_suffix"`
+	DeltaSuffix        string   `toml:"delta_suffix"`
+	RateMetricsFilter  filter.Filter
+	DeltaMetricsFilter filter.Filter
+	counterTracker     *derive.Tracker `toml:"-"`
+
+	// suppress samples whose value is unchanged since the last emission, they
+	// are sent again every dedup_heartbeat anyway and stay exposed on /metrics
+	Dedup          bool        `toml:"dedup"`
+	DedupHeartbeat Duration    `toml:"dedup_heartbeat"`
+	dedupCache     *dedupCache `toml:"-"`
+
 	// whether debug
 	DebugMod bool `toml:"-"`
 }
@@ -131,16 +149,41 @@ func (ic *InternalConfig) InitInternalConfig() error {
 		}
 	}
 
+	if len(ic.RateMetrics) > 0 || len(ic.DeltaMetrics) > 0 {
+		if ic.RateSuffix == "" {
+			ic.RateSuffix = "_rate"
+		}
+		if ic.DeltaSuffix == "" {
+			ic.DeltaSuffix = "_delta"
+		}
+		var err error
+		if ic.RateMetricsFilter, err = filter.Compile(ic.RateMetrics); err != nil {
+			return err
+		}
+		if ic.DeltaMetricsFilter, err = filter.Compile(ic.DeltaMetrics); err != nil {
+			return err
+		}
+		ic.counterTracker = derive.NewTracker(time.Hour)
+	}
+
+	if ic.Dedup {
+		ic.dedupCache = newDedupCache(time.Duration(ic.DedupHeartbeat))
+	}
+
 	return nil
 }
 
 func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
+	return ic.ProcessAt(slist, time.Now())
+}
+
+// ProcessAt is Process, samples without timestamp are stamped with now
+func (ic *InternalConfig) ProcessAt(slist *types.SampleList, now time.Time) *types.SampleList {
 	nlst := types.NewSampleList()
 	if slist.Len() == 0 {
 		return nlst
 	}
 
-	now := time.Now()
 	ss := slist.PopBackAll()
 
 	for i := range ss {
@@ -221,12 +264,47 @@ func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
 			ss[i].Labels = newLabel
 		}
 
+		// counter to rate / delta
+		if ic.counterTracker != nil && !ic.derive(ss[i]) {
+			continue
+		}
+
+		// change-only emission, unchanged samples are kept for /metrics
+		if ic.dedupCache != nil && !ic.dedupCache.emit(ss[i], now) {
+			ss[i].Suppressed = true
+		}
+
 		nlst.PushFront(ss[i])
 	}
 
 	return nlst
 }
 
+// derive replaces the value of counters matching rate_metrics or delta_metrics with
+// the rate or delta since the previous gather. It returns false for the first value
+// of a series, which has nothing to compare with.
+func (ic *InternalConfig) derive(s *types.Sample) bool {
+	rate := ic.RateMetricsFilter != nil && ic.RateMetricsFilter.Match(s.Metric)
+	if !rate && (ic.DeltaMetricsFilter == nil || !ic.DeltaMetricsFilter.Match(s.Metric)) {
+		return true
+	}
+	v, err := conv.ToFloat64(s.Value)
+	if err != nil {
+		return true
+	}
+
+	var ok bool
+	if rate {
+		s.Value, ok = ic.counterTracker.Rate(s.SeriesKey(), v, s.Timestamp)
+		s.Metric += ic.RateSuffix
+	} else {
+		s.Value, _, ok = ic.counterTracker.Delta(s.SeriesKey(), v, s.Timestamp)
+		s.Metric += ic.DeltaSuffix
+	}
+	s.Type = types.Gauge
+	return ok
+}
+
 func (ic *InternalConfig) Initialized() bool {
 	return ic.inited
 }
@@ -238,17 +316,60 @@ func (ic *InternalConfig) SetInitialized() {
 type PluginConfig struct {
 	InternalConfig
 	Interval Duration `toml:"interval"`
+	// a gather taking longer is abandoned, 0 means no limit
+	GatherTimeout Duration `toml:"gather_timeout"`
+	// override those of global
+	CollectionJitter Duration `toml:"collection_jitter"`
+	RoundInterval    *bool    `toml:"round_interval"`
+	Precision        string   `toml:"precision"`
+	TickTimestamp    *bool    `toml:"tick_timestamp"`
+}
+
+// InitInternalConfig checks precision as well, an unknown one would not truncate timestamps
+func (pc *PluginConfig) InitInternalConfig() error {
+	switch pc.Precision {
+	case "", "ms", "s", "m":
+	default:
+		return fmt.Errorf("invalid precision %q, should be ms, s or m", pc.Precision)
+	}
+	return pc.InternalConfig.InitInternalConfig()
 }
 
 func (pc *PluginConfig) GetInterval() Duration {
 	return pc.Interval
 }
 
+func (pc *PluginConfig) GetGatherTimeout() Duration {
+	return pc.GatherTimeout
+}
+
+func (pc *PluginConfig) GetCollectionJitter() Duration {
+	return pc.CollectionJitter
+}
+
+func (pc *PluginConfig) GetRoundInterval() *bool {
+	return pc.RoundInterval
+}
+
+func (pc *PluginConfig) GetPrecision() string {
+	return pc.Precision
+}
+
+func (pc *PluginConfig) GetTickTimestamp() *bool {
+	return pc.TickTimestamp
+}
+
 type InstanceConfig struct {
 	InternalConfig
 	IntervalTimes int64 `toml:"interval_times"`
+	// overrides gather_timeout of the input
+	GatherTimeout Duration `toml:"gather_timeout"`
 }
 
 func (ic *InstanceConfig) GetIntervalTimes() int64 {
 	return ic.IntervalTimes
 }
+
+func (ic *InstanceConfig) GetGatherTimeout() Duration {
+	return ic.GatherTimeout
+}
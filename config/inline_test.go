@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestDeriveCounters(t *testing.T) {
+	ic := &InternalConfig{RateMetrics: []string{"net_bytes_*"}}
+	Config = &ConfigType{}
+	require.NoError(t, ic.InitInternalConfig())
+
+	now := time.Now()
+	s := types.NewSample("", "net_bytes_recv", 1000).SetTime(now)
+	require.False(t, ic.derive(s))
+
+	s = types.NewSample("", "net_bytes_recv", 3000).SetTime(now.Add(10 * time.Second))
+	require.True(t, ic.derive(s))
+	require.Equal(t, "net_bytes_recv_rate", s.Metric)
+	require.Equal(t, 200.0, s.Value)
+
+	other := types.NewSample("", "net_packets_recv", 5)
+	require.True(t, ic.derive(other))
+	require.Equal(t, 5, other.Value)
+}
+
+func TestPluginConfigPrecision(t *testing.T) {
+	Config = &ConfigType{}
+	require.NoError(t, (&PluginConfig{Precision: "s"}).InitInternalConfig())
+	require.NoError(t, (&PluginConfig{}).InitInternalConfig())
+	require.Error(t, (&PluginConfig{Precision: "sec"}).InitInternalConfig())
+}
+
+func TestDedupMarksSuppressed(t *testing.T) {
+	ic := &InternalConfig{Dedup: true}
+	Config = &ConfigType{Global: Global{OmitHostname: true}}
+	require.NoError(t, ic.InitInternalConfig())
+
+	now := time.Now()
+	gather := func(at time.Time) *types.Sample {
+		slist := types.NewSampleList()
+		slist.PushSample("", "systemd_unit_state", 1)
+		ss := ic.ProcessAt(slist, at).PopBackAll()
+		require.Len(t, ss, 1)
+		return ss[0]
+	}
+	require.False(t, gather(now).Suppressed)
+	// unchanged samples are kept for /metrics, but not written
+	require.True(t, gather(now.Add(10*time.Second)).Suppressed)
+}
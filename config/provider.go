@@ -2,6 +2,14 @@ package config
 
 import "flashcat.cloud/categraf/pkg/tls"
 
+// LocalProviderConfig controls how the local provider picks up changes of conf/input.*
+type LocalProviderConfig struct {
+	// reload the changed inputs when files under conf/input.* change, no SIGHUP needed
+	Watch bool `toml:"watch"`
+	// rescan interval when inotify is not available
+	PollInterval Duration `toml:"poll_interval"`
+}
+
 type HTTPProviderConfig struct {
 	tls.ClientConfig
 
@@ -11,4 +19,36 @@ type HTTPProviderConfig struct {
 	AuthPassword   string   `toml:"basic_auth_pass"`
 	Timeout        int      `toml:"timeout"`
 	ReloadInterval int      `toml:"reload_interval"`
+
+	// the last applied configs are saved to cache_file, and loaded when remote_url is unreachable at startup
+	CacheFile string `toml:"cache_file"`
+	// send If-None-Match and ask the server to hold the request until configs change. servers not
+	// holding it, or answering without an ETag, are requested every reload_interval
+	LongPoll        bool `toml:"long_poll"`
+	LongPollTimeout int  `toml:"long_poll_timeout"`
+
+	// verify the signature of the response body: ed25519 or hmac-sha256
+	SignatureType   string `toml:"signature_type"`
+	SignatureKey    string `toml:"signature_key"`
+	SignatureHeader string `toml:"signature_header"`
+}
+
+// KVProviderConfig is the config of consul and etcd providers, input configs are
+// read from keys like <prefix>/input.cpu/cpu.toml
+type KVProviderConfig struct {
+	tls.ClientConfig
+
+	// consul: http://127.0.0.1:8500, etcd: http://127.0.0.1:2379
+	Endpoints []string `toml:"endpoints"`
+	// consul acl token
+	Token      string `toml:"token"`
+	Datacenter string `toml:"datacenter"`
+	// etcd user, or consul http basic auth
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// key prefixes to read, $hostname, $ip, $sn, env vars and ${labels.<name>} of global labels are expanded
+	Prefixes []string `toml:"prefixes"`
+	// max time of a blocking query or watch
+	WaitTime Duration `toml:"wait_time"`
 }
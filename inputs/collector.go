@@ -6,6 +6,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	util "flashcat.cloud/categraf/pkg/metrics"
 	"flashcat.cloud/categraf/types"
@@ -59,17 +60,47 @@ func Collect(e prometheus.Collector, slist *types.SampleList, constLabels ...map
 
 		switch {
 		case dtoMetric.Counter != nil:
-			slist.PushSample("", desc.Name(), *dtoMetric.Counter.Value, labels)
+			s := types.NewSample("", desc.Name(), *dtoMetric.Counter.Value, labels).SetType(types.Counter)
+			if ct := dtoMetric.Counter.GetCreatedTimestamp(); ct != nil {
+				s.Created = ct.AsTime()
+			}
+			slist.PushFront(withHelp(s, desc))
 		case dtoMetric.Gauge != nil:
-			slist.PushSample("", desc.Name(), *dtoMetric.Gauge.Value, labels)
+			slist.PushFront(withHelp(types.NewSample("", desc.Name(), *dtoMetric.Gauge.Value, labels).SetType(types.Gauge), desc))
 		case dtoMetric.Summary != nil:
-			util.HandleSummary("", dtoMetric, nil, desc.Name(), nil, slist)
+			tmp := types.NewSampleList()
+			util.HandleSummary("", dtoMetric, nil, desc.Name(), nil, tmp)
+			pushWithMetadata(slist, tmp, desc, dtoMetric.Summary.GetCreatedTimestamp())
 		case dtoMetric.Histogram != nil:
-			util.HandleHistogram("", dtoMetric, nil, desc.Name(), nil, slist)
+			tmp := types.NewSampleList()
+			if util.IsNativeHistogram(dtoMetric.Histogram) {
+				s := types.NewSample("", desc.Name(), nil, labels).SetType(types.Histogram)
+				s.Histogram = util.NativeHistogram(dtoMetric.Histogram)
+				tmp.PushFront(s)
+			}
+			// the classic _bucket/_sum/_count series are kept for native histograms as well,
+			// writers other than remote write 2.0 only send them
+			util.HandleHistogram("", dtoMetric, nil, desc.Name(), nil, tmp)
+			pushWithMetadata(slist, tmp, desc, dtoMetric.Histogram.GetCreatedTimestamp())
 		default:
-			slist.PushSample("", desc.Name(), *dtoMetric.Untyped.Value, labels)
+			slist.PushFront(withHelp(types.NewSample("", desc.Name(), *dtoMetric.Untyped.Value, labels).SetType(types.Untyped), desc))
 		}
 	}
 
 	return nil
 }
+
+func withHelp(s *types.Sample, desc *prometheus.Desc) *types.Sample {
+	s.Help = desc.Help()
+	return s
+}
+
+func pushWithMetadata(slist, tmp *types.SampleList, desc *prometheus.Desc, ct *timestamppb.Timestamp) {
+	for _, s := range tmp.PopBackAll() {
+		s.Help = desc.Help()
+		if ct != nil {
+			s.Created = ct.AsTime()
+		}
+		slist.PushFront(s)
+	}
+}
@@ -0,0 +1,87 @@
+package inputs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GatherCounter counts the gathers of an input, or one of its instances, that went wrong
+type GatherCounter struct {
+	Input    string `json:"input"`
+	Provider string `json:"provider"`
+	Checksum string `json:"checksum"`
+	// index of the instance, empty for the input itself
+	Instance string `json:"instance,omitempty"`
+	// gathers abandoned after gather_timeout
+	Timeouts uint64 `json:"timeouts"`
+	// rounds skipped because the previous gather was still running
+	Skipped uint64 `json:"skipped"`
+}
+
+var gatherCounters = struct {
+	sync.Mutex
+	m map[string]*GatherCounter
+}{m: make(map[string]*GatherCounter)}
+
+// gatherCounter returns the counter of an instance of input name with checksum sum, keyed like init states
+func gatherCounter(name, sum, instance string) *GatherCounter {
+	key := initStateKey(name, sum, instance)
+	c, has := gatherCounters.m[key]
+	if !has {
+		provider, inputKey := ParseInputName(name)
+		c = &GatherCounter{Input: inputKey, Provider: provider, Checksum: sum, Instance: instance}
+		gatherCounters.m[key] = c
+	}
+	return c
+}
+
+// AddGatherTimeout counts a gather of input name abandoned after gather_timeout
+func AddGatherTimeout(name, sum, instance string) {
+	gatherCounters.Lock()
+	defer gatherCounters.Unlock()
+	gatherCounter(name, sum, instance).Timeouts++
+}
+
+// AddGatherSkipped counts a round of input name skipped as the previous gather was still running
+func AddGatherSkipped(name, sum, instance string) {
+	gatherCounters.Lock()
+	defer gatherCounters.Unlock()
+	gatherCounter(name, sum, instance).Skipped++
+}
+
+// DelGatherCounters deletes the counters of input name with checksum sum and its instances, once it stops
+func DelGatherCounters(name, sum string) {
+	gatherCounters.Lock()
+	defer gatherCounters.Unlock()
+	prefix := initStateKey(name, sum, "")
+	for key := range gatherCounters.m {
+		if strings.HasPrefix(key, prefix) {
+			delete(gatherCounters.m, key)
+		}
+	}
+}
+
+// GatherCounters returns the counters of all inputs, sorted by input
+func GatherCounters() []GatherCounter {
+	gatherCounters.Lock()
+	ret := make([]GatherCounter, 0, len(gatherCounters.m))
+	for _, c := range gatherCounters.m {
+		ret = append(ret, *c)
+	}
+	gatherCounters.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Input != ret[j].Input {
+			return ret[i].Input < ret[j].Input
+		}
+		if ret[i].Provider != ret[j].Provider {
+			return ret[i].Provider < ret[j].Provider
+		}
+		if ret[i].Checksum != ret[j].Checksum {
+			return ret[i].Checksum < ret[j].Checksum
+		}
+		return ret[i].Instance < ret[j].Instance
+	})
+	return ret
+}
@@ -2,10 +2,12 @@ package inputs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -30,13 +32,23 @@ type (
 		Timeout        int
 		ReloadInterval int
 
+		CacheFile       string
+		LongPoll        bool
+		LongPollTimeout int
+
+		SignatureType   string
+		SignatureKey    string
+		SignatureHeader string
+
 		tls.ClientConfig
-		client *http.Client
-		stopCh chan struct{}
-		op     InputOperation
+		client   *http.Client
+		stopCh   chan struct{}
+		op       InputOperation
+		verifier signatureVerifier
 
 		configMap map[string]map[string]*cfg.ConfigWithFormat
 		version   string
+		etag      string
 
 		cache *innerCache
 		add   *innerCache
@@ -102,6 +114,11 @@ type httpProviderResponse struct {
 
 	// ConfigMap (InputName -> Config), if version is identical, server side can set Config to nil
 	Configs map[string]map[string]*cfg.ConfigWithFormat `json:"configs"`
+
+	// raw response, kept for the cache file
+	body      []byte
+	signature string
+	etag      string
 }
 
 func (hrp *HTTPProvider) Name() string {
@@ -114,16 +131,22 @@ func newHTTPProvider(c *config.ConfigType, op InputOperation) (*HTTPProvider, er
 	}
 
 	provider := &HTTPProvider{
-		RemoteUrl:      c.HTTPProviderConfig.RemoteUrl,
-		Headers:        c.HTTPProviderConfig.Headers,
-		AuthUsername:   c.HTTPProviderConfig.AuthUsername,
-		AuthPassword:   c.HTTPProviderConfig.AuthPassword,
-		ClientConfig:   c.HTTPProviderConfig.ClientConfig,
-		Timeout:        c.HTTPProviderConfig.Timeout,
-		ReloadInterval: c.HTTPProviderConfig.ReloadInterval,
-		stopCh:         make(chan struct{}, 1),
-		op:             op,
-		cache:          newInnerCache(),
+		RemoteUrl:       c.HTTPProviderConfig.RemoteUrl,
+		Headers:         c.HTTPProviderConfig.Headers,
+		AuthUsername:    c.HTTPProviderConfig.AuthUsername,
+		AuthPassword:    c.HTTPProviderConfig.AuthPassword,
+		ClientConfig:    c.HTTPProviderConfig.ClientConfig,
+		Timeout:         c.HTTPProviderConfig.Timeout,
+		ReloadInterval:  c.HTTPProviderConfig.ReloadInterval,
+		CacheFile:       c.HTTPProviderConfig.CacheFile,
+		LongPoll:        c.HTTPProviderConfig.LongPoll,
+		LongPollTimeout: c.HTTPProviderConfig.LongPollTimeout,
+		SignatureType:   c.HTTPProviderConfig.SignatureType,
+		SignatureKey:    c.HTTPProviderConfig.SignatureKey,
+		SignatureHeader: c.HTTPProviderConfig.SignatureHeader,
+		stopCh:          make(chan struct{}, 1),
+		op:              op,
+		cache:           newInnerCache(),
 	}
 
 	if err := provider.check(); err != nil {
@@ -142,6 +165,18 @@ func (hrp *HTTPProvider) check() error {
 		hrp.ReloadInterval = 120
 	}
 
+	if hrp.CacheFile == "" {
+		hrp.CacheFile = "./data/http_provider.json"
+	}
+
+	if hrp.LongPollTimeout <= 0 {
+		hrp.LongPollTimeout = 60
+	}
+
+	if hrp.SignatureHeader == "" {
+		hrp.SignatureHeader = defaultSignatureHeader
+	}
+
 	if !strings.HasPrefix(hrp.RemoteUrl, "http") {
 		return fmt.Errorf("http provider: bad remote url config: %s", hrp.RemoteUrl)
 	}
@@ -151,8 +186,19 @@ func (hrp *HTTPProvider) check() error {
 		return err
 	}
 
+	verifier, err := newSignatureVerifier(hrp.SignatureType, hrp.SignatureKey)
+	if err != nil {
+		return fmt.Errorf("http provider: %v", err)
+	}
+	hrp.verifier = verifier
+
+	// the server holds long poll requests up to long_poll_timeout
+	timeout := time.Duration(hrp.Timeout) * time.Second
+	if hrp.LongPoll {
+		timeout += time.Duration(hrp.LongPollTimeout) * time.Second
+	}
 	hrp.client = &http.Client{
-		Timeout: time.Duration(hrp.Timeout) * time.Second,
+		Timeout: timeout,
 		Transport: &http.Transport{
 			TLSClientConfig: tlsc,
 		},
@@ -161,6 +207,9 @@ func (hrp *HTTPProvider) check() error {
 	return nil
 }
 
+// errNotModified means the configs did not change since the last response
+var errNotModified = errors.New("not modified")
+
 func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
 	req, err := http.NewRequest("GET", hrp.RemoteUrl, nil)
 	if err != nil {
@@ -179,14 +228,24 @@ func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
 		req.SetBasicAuth(hrp.AuthUsername, hrp.AuthPassword)
 	}
 
+	hrp.RLock()
+	version, etag := hrp.version, hrp.etag
+	hrp.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
 	// build query parameters
 	q := req.URL.Query()
 	for k, v := range config.GlobalLabels() {
 		q.Add(k, v)
 	}
 	q.Add("timestamp", fmt.Sprint(time.Now().Unix()))
-	q.Add("version", hrp.version)
+	q.Add("version", version)
 	q.Add("agent_hostname", config.Config.GetHostname())
+	if hrp.LongPoll && etag != "" {
+		q.Add("wait", fmt.Sprintf("%ds", hrp.LongPollTimeout))
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := hrp.client.Do(req)
@@ -195,18 +254,43 @@ func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
 	respData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Println("E! http provider: request reload config error:", err)
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http provider: unexpected status code %d: %s", resp.StatusCode, respData)
+	}
+
+	confResp, err := hrp.parseResponse(respData, resp.Header.Get(hrp.SignatureHeader))
+	if err != nil {
+		return nil, err
+	}
+	confResp.etag = resp.Header.Get("ETag")
+	return confResp, nil
+}
+
+// parseResponse verifies the signature of body and decodes it
+func (hrp *HTTPProvider) parseResponse(body []byte, signature string) (*httpProviderResponse, error) {
+	if hrp.verifier != nil {
+		if err := hrp.verifier.verify(body, signature); err != nil {
+			log.Println("E! http provider: configs rejected:", err)
+			return nil, err
+		}
+	}
 
 	confResp := &httpProviderResponse{}
-	err = json.Unmarshal(respData, confResp)
+	err := json.Unmarshal(body, confResp)
 	if err != nil {
 		log.Println("E! http provider: unmarshal result error:", err)
 		return nil, err
 	}
+	confResp.body = body
+	confResp.signature = signature
 
 	// set checksum for each config
 	newCfg := make(map[string]map[string]*cfg.ConfigWithFormat)
@@ -229,14 +313,38 @@ func (hrp *HTTPProvider) LoadConfig() (bool, error) {
 	log.Println("I! http provider: start reload config from remote:", hrp.RemoteUrl)
 
 	confResp, err := hrp.doReq()
+	if err == errNotModified {
+		return false, nil
+	}
 	if err != nil {
 		log.Printf("W! http provider: request remote err: [%+v]", err)
+		hrp.RLock()
+		loaded := hrp.configMap != nil
+		hrp.RUnlock()
+		// boot with the configs applied last time
+		if !loaded && hrp.CacheFile != "" {
+			if confResp, cerr := hrp.loadCache(); cerr == nil {
+				log.Println("I! http provider: remote unreachable, load configs from cache file:", hrp.CacheFile)
+				return hrp.apply(confResp, false), nil
+			} else if !os.IsNotExist(cerr) {
+				log.Println("W! http provider: failed to load cache file:", cerr)
+			}
+		}
 		return false, err
 	}
 
+	return hrp.apply(confResp, true), nil
+}
+
+// apply replaces the configs with confResp if the version changed, it returns whether any input changed
+func (hrp *HTTPProvider) apply(confResp *httpProviderResponse, save bool) bool {
+	hrp.Lock()
+	hrp.etag = confResp.etag
+	hrp.Unlock()
+
 	// if config version is identical, means config is not changed
 	if confResp.Version == hrp.version {
-		return false, nil
+		return false
 	}
 	log.Printf("I! remote version:%s, current version:%s", confResp.Version, hrp.version)
 
@@ -249,14 +357,19 @@ func (hrp *HTTPProvider) LoadConfig() (bool, error) {
 
 	hrp.caculateDiff(confResp.Configs)
 	changed := hrp.add.len()+hrp.del.len() > 0
-	if changed {
+	if changed || hrp.configMap == nil {
 		hrp.Lock()
 		hrp.configMap = confResp.Configs
 		hrp.version = confResp.Version
 		hrp.Unlock()
+		if save && hrp.CacheFile != "" {
+			if err := hrp.saveCache(confResp); err != nil {
+				log.Println("W! http provider: failed to save cache file:", err)
+			}
+		}
 	}
 
-	return changed, nil
+	return changed
 }
 
 func (hrp *HTTPProvider) serviceInput(inputKey string) bool {
@@ -281,10 +394,14 @@ func (hrp *HTTPProvider) preStop(inputKey string) error {
 
 func (hrp *HTTPProvider) StartReloader() {
 	go func() {
+		// the configs were just loaded by the agent
+		interval := hrp.nextInterval(nil, true, 0)
 		for {
 			select {
-			case <-time.After(time.Duration(hrp.ReloadInterval) * time.Second):
+			case <-time.After(interval):
+				start := time.Now()
 				changed, err := hrp.LoadConfig()
+				interval = hrp.nextInterval(err, changed, time.Since(start))
 				if err != nil {
 					continue
 				}
@@ -319,6 +436,22 @@ func (hrp *HTTPProvider) StartReloader() {
 	}()
 }
 
+// nextInterval is the wait before the next request, given the result of the last one and how long
+// it took. Long poll requests are sent again right away if the server held the last one, or answered
+// it early with changed configs. A server answering without an ETag, or right away with the same
+// configs, does not support long poll, it is requested every reload_interval as well.
+func (hrp *HTTPProvider) nextInterval(err error, changed bool, elapsed time.Duration) time.Duration {
+	hrp.RLock()
+	etag := hrp.etag
+	hrp.RUnlock()
+
+	held := elapsed >= time.Duration(hrp.LongPollTimeout)*time.Second*9/10
+	if hrp.LongPoll && err == nil && etag != "" && (changed || held) {
+		return time.Second
+	}
+	return time.Duration(hrp.ReloadInterval) * time.Second
+}
+
 func (hrp *HTTPProvider) StopReloader() {
 	hrp.stopCh <- struct{}{}
 }
@@ -351,9 +484,21 @@ func (hrp *HTTPProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat
 }
 
 func (hrp *HTTPProvider) caculateDiff(newConfigs map[string]map[string]*cfg.ConfigWithFormat) {
-	hrp.add = newInnerCache()
-	hrp.del = newInnerCache()
-	cache := newInnerCache()
+	var cache *innerCache
+	hrp.add, hrp.del, cache = calculateDiff(hrp.cache, newConfigs)
+	if hrp.add.len()+hrp.del.len() > 0 {
+		hrp.Lock()
+		hrp.cache = cache
+		hrp.Unlock()
+	}
+}
+
+// calculateDiff compares newConfigs with the configs in cache by checksum, it returns the
+// configs added and deleted, and the cache of newConfigs
+func calculateDiff(old *innerCache, newConfigs map[string]map[string]*cfg.ConfigWithFormat) (add, del, cache *innerCache) {
+	add = newInnerCache()
+	del = newInnerCache()
+	cache = newInnerCache()
 	for inputKey, configs := range newConfigs {
 		for _, inputConfig := range configs {
 			if config.Config.DebugMode {
@@ -364,57 +509,57 @@ func (hrp *HTTPProvider) caculateDiff(newConfigs map[string]map[string]*cfg.Conf
 	}
 
 	for inputKey, configMap := range cache.iter() {
-		if oldConfigMap, has := hrp.cache.get(inputKey); has {
+		if oldConfigMap, has := old.get(inputKey); has {
 			new := set.NewWithLoad[string, cfg.ConfigWithFormat](configMap)
 			old := set.NewWithLoad[string, cfg.ConfigWithFormat](oldConfigMap)
-			add, _, del := new.Diff(old)
-			for sum := range add {
+			added, _, deleted := new.Diff(old)
+			for sum := range added {
 				if config.Config.DebugMode {
 					log.Println("D!: add config:", inputKey, "config sum:", sum)
 				}
-				hrp.add.put(inputKey, configMap[sum])
+				add.put(inputKey, configMap[sum])
 			}
-			for sum := range del {
+			for sum := range deleted {
 				if config.Config.DebugMode {
 					log.Println("D!: delete config:", inputKey, "config sum:", sum)
 				}
-				hrp.del.put(inputKey, oldConfigMap[sum])
+				del.put(inputKey, oldConfigMap[sum])
 			}
 		} else {
 			for _, inputConfig := range configMap {
 				if config.Config.DebugMode {
 					log.Println("D!: add config:", inputKey, "config sum:", inputConfig.CheckSum())
 				}
-				hrp.add.put(inputKey, inputConfig)
+				add.put(inputKey, inputConfig)
 			}
 		}
 	}
 
-	for inputKey, configMap := range hrp.cache.iter() {
+	for inputKey, configMap := range old.iter() {
 		if _, has := cache.get(inputKey); !has {
 			for _, inputConfig := range configMap {
 				if config.Config.DebugMode {
 					log.Println("D!: delete config:", inputKey, "config sum:", inputConfig.CheckSum())
 				}
-				hrp.del.put(inputKey, inputConfig)
+				del.put(inputKey, inputConfig)
 			}
 		}
 	}
-	if hrp.add.len()+hrp.del.len() > 0 {
-		hrp.Lock()
-		hrp.cache = cache
-		hrp.Unlock()
-	}
-
+	return add, del, cache
 }
 
 func (hrp *HTTPProvider) LoadInputConfig(configs []cfg.ConfigWithFormat, input Input) (map[string]Input, error) {
+	return loadInputConfigs(configs, input)
+}
+
+// loadInputConfigs creates an input for every config, keyed by the checksum of the config
+func loadInputConfigs(configs []cfg.ConfigWithFormat, input Input) (map[string]Input, error) {
 	inputs := make(map[string]Input)
 	for _, c := range configs {
 		nInput := input.Clone()
 		err := cfg.LoadSingleConfig(c, nInput)
 		if err != nil {
-			log.Println("E! load http config error:", err)
+			log.Println("E! load input config error:", err)
 			if config.Config.DebugMode {
 				log.Printf("D! config:%+v load error:%s", c, err)
 			}
@@ -0,0 +1,153 @@
+package inputs
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultSignatureHeader = "X-Categraf-Signature"
+
+// signatureVerifier checks the base64 signature of a response body
+type signatureVerifier interface {
+	verify(body []byte, signature string) error
+}
+
+type (
+	ed25519Verifier struct {
+		key ed25519.PublicKey
+	}
+	hmacVerifier struct {
+		secret []byte
+	}
+)
+
+// newSignatureVerifier returns nil if typ is empty. The ed25519 key is a PEM public key or
+// the base64 of the raw key, the hmac-sha256 key is the shared secret.
+func newSignatureVerifier(typ, key string) (signatureVerifier, error) {
+	switch strings.ToLower(typ) {
+	case "":
+		return nil, nil
+	case "ed25519":
+		pub, err := parseEd25519Key(key)
+		if err != nil {
+			return nil, err
+		}
+		return &ed25519Verifier{key: pub}, nil
+	case "hmac-sha256", "hmac":
+		if key == "" {
+			return nil, errors.New("signature_key is empty")
+		}
+		return &hmacVerifier{secret: []byte(key)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signature_type: %s", typ)
+	}
+}
+
+func parseEd25519Key(key string) (ed25519.PublicKey, error) {
+	key = strings.TrimSpace(key)
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ed25519 public key: %v", err)
+		}
+		if k, ok := pub.(ed25519.PublicKey); ok {
+			return k, nil
+		}
+		return nil, errors.New("signature_key is not an ed25519 public key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key, expect PEM or base64 of 32 bytes")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+func decodeSignature(signature string) ([]byte, error) {
+	if signature == "" {
+		return nil, errors.New("signature is missing")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+	return sig, nil
+}
+
+func (v *ed25519Verifier) verify(body []byte, signature string) error {
+	sig, err := decodeSignature(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.key, body, sig) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (v *hmacVerifier) verify(body []byte, signature string) error {
+	sig, err := decodeSignature(signature)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// httpProviderCache is the content of cache file, the body is kept as received so that
+// the signature is checked again when it's loaded
+type httpProviderCache struct {
+	Body      []byte `json:"body"`
+	Signature string `json:"signature,omitempty"`
+	ETag      string `json:"etag,omitempty"`
+}
+
+func (hrp *HTTPProvider) saveCache(confResp *httpProviderResponse) error {
+	data, err := json.Marshal(httpProviderCache{
+		Body:      confResp.body,
+		Signature: confResp.signature,
+		ETag:      confResp.etag,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(hrp.CacheFile), 0o755); err != nil {
+		return err
+	}
+	// configs may carry credentials
+	tmp := hrp.CacheFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, hrp.CacheFile)
+}
+
+func (hrp *HTTPProvider) loadCache() (*httpProviderResponse, error) {
+	data, err := os.ReadFile(hrp.CacheFile)
+	if err != nil {
+		return nil, err
+	}
+	var c httpProviderCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", hrp.CacheFile, err)
+	}
+	confResp, err := hrp.parseResponse(c.Body, c.Signature)
+	if err != nil {
+		return nil, err
+	}
+	confResp.etag = c.ETag
+	return confResp, nil
+}
@@ -0,0 +1,152 @@
+package inputs
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+const testProviderBody = `{"version":"v1","configs":{"cpu":{"sum1":{"config":"interval = 15","format":"toml"}}}}`
+
+func newTestHTTPProvider(t *testing.T, url string, c config.HTTPProviderConfig) *HTTPProvider {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	if config.HostInfo == nil {
+		config.HostInfo = &config.HostInfoCache{}
+	}
+	c.RemoteUrl = url
+	if c.CacheFile == "" {
+		c.CacheFile = filepath.Join(t.TempDir(), "cache.json")
+	}
+	hrp, err := newHTTPProvider(&config.ConfigType{HTTPProviderConfig: &c}, &recordOperation{})
+	require.NoError(t, err)
+	return hrp
+}
+
+func TestHTTPProviderETag(t *testing.T) {
+	var notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			require.Equal(t, "60s", r.URL.Query().Get("wait"))
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(testProviderBody))
+	}))
+	defer srv.Close()
+
+	hrp := newTestHTTPProvider(t, srv.URL, config.HTTPProviderConfig{LongPoll: true})
+	changed, err := hrp.LoadConfig()
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	changed, err = hrp.LoadConfig()
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.EqualValues(t, 1, notModified.Load())
+}
+
+func TestHTTPProviderNextInterval(t *testing.T) {
+	hrp := newTestHTTPProvider(t, "http://127.0.0.1", config.HTTPProviderConfig{LongPoll: true, ReloadInterval: 120})
+	reload := 120 * time.Second
+
+	// no ETag, long poll is not supported
+	require.Equal(t, reload, hrp.nextInterval(nil, true, 0))
+
+	hrp.etag = `"v1"`
+	require.Equal(t, time.Second, hrp.nextInterval(nil, true, 0))
+	require.Equal(t, time.Second, hrp.nextInterval(nil, false, 60*time.Second))
+	// answered right away with the same configs
+	require.Equal(t, reload, hrp.nextInterval(nil, false, 10*time.Millisecond))
+	require.Equal(t, reload, hrp.nextInterval(errors.New("timeout"), false, 60*time.Second))
+}
+
+func TestHTTPProviderSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(testProviderBody))
+
+	signatures := map[string]string{
+		"ed25519":     base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(testProviderBody))),
+		"hmac-sha256": base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}
+	keys := map[string]string{
+		"ed25519":     base64.StdEncoding.EncodeToString(pub),
+		"hmac-sha256": "secret",
+	}
+
+	for typ, signature := range signatures {
+		t.Run(typ, func(t *testing.T) {
+			var sig atomic.Value
+			sig.Store("bad")
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(defaultSignatureHeader, sig.Load().(string))
+				w.Write([]byte(testProviderBody))
+			}))
+			defer srv.Close()
+
+			hrp := newTestHTTPProvider(t, srv.URL, config.HTTPProviderConfig{
+				SignatureType: typ,
+				SignatureKey:  keys[typ],
+			})
+			_, err := hrp.LoadConfig()
+			require.Error(t, err)
+			inputs, _ := hrp.GetInputs()
+			require.Empty(t, inputs)
+
+			sig.Store(signature)
+			changed, err := hrp.LoadConfig()
+			require.NoError(t, err)
+			require.True(t, changed)
+		})
+	}
+}
+
+func TestHTTPProviderBootFromCache(t *testing.T) {
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(testProviderBody))
+	}))
+	defer srv.Close()
+
+	cacheFile := filepath.Join(t.TempDir(), "data", "cache.json")
+	hrp := newTestHTTPProvider(t, srv.URL, config.HTTPProviderConfig{CacheFile: cacheFile})
+	changed, err := hrp.LoadConfig()
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	down.Store(true)
+	hrp = newTestHTTPProvider(t, srv.URL, config.HTTPProviderConfig{CacheFile: cacheFile})
+	changed, err = hrp.LoadConfig()
+	require.NoError(t, err)
+	require.True(t, changed)
+	configs, _ := hrp.GetInputConfig("cpu")
+	require.Len(t, configs, 1)
+	require.Equal(t, "interval = 15", configs[0].Config)
+
+	// remote errors after startup keep the configs
+	changed, err = hrp.LoadConfig()
+	require.Error(t, err)
+	require.False(t, changed)
+}
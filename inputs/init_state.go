@@ -0,0 +1,118 @@
+package inputs
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InitState is the init result of an input, or one of its instances
+type InitState struct {
+	Input    string `json:"input"`
+	Provider string `json:"provider"`
+	// of the config, an input of the http or kv provider has one per config
+	Checksum string `json:"checksum"`
+	// index of the instance, empty for the input itself
+	Instance string `json:"instance,omitempty"`
+	Up       bool   `json:"up"`
+	// init attempts so far
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+var initStates = struct {
+	sync.Mutex
+	m map[string]*InitState
+}{m: make(map[string]*InitState)}
+
+func initStateKey(name, sum, instance string) string {
+	return name + "/" + sum + "/" + instance
+}
+
+// InstanceIndex is the instance value of InitState for the i-th instance
+func InstanceIndex(i int) string {
+	return strconv.Itoa(i)
+}
+
+// SetInitState records the result of an init attempt of input name, it returns the state
+func SetInitState(name, sum, instance string, err error) InitState {
+	initStates.Lock()
+	defer initStates.Unlock()
+
+	key := initStateKey(name, sum, instance)
+	st, has := initStates.m[key]
+	if !has {
+		provider, inputKey := ParseInputName(name)
+		st = &InitState{Input: inputKey, Provider: provider, Checksum: sum, Instance: instance, Since: time.Now()}
+		initStates.m[key] = st
+	}
+	st.Attempts++
+	up := err == nil
+	if up != st.Up {
+		st.Since = time.Now()
+	}
+	st.Up = up
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+	return *st
+}
+
+// DelInitStates forgets the states of input name with checksum sum, or all of name if sum is empty
+func DelInitStates(name, sum string) {
+	initStates.Lock()
+	defer initStates.Unlock()
+
+	prefix := name + "/"
+	if sum != "" {
+		prefix += sum + "/"
+	}
+	for key := range initStates.m {
+		if strings.HasPrefix(key, prefix) {
+			delete(initStates.m, key)
+		}
+	}
+}
+
+// InitStatesOf returns the init states of input name with checksum sum, by instance
+func InitStatesOf(name, sum string) map[string]InitState {
+	initStates.Lock()
+	defer initStates.Unlock()
+
+	prefix := name + "/" + sum + "/"
+	ret := make(map[string]InitState)
+	for key, st := range initStates.m {
+		if strings.HasPrefix(key, prefix) {
+			ret[st.Instance] = *st
+		}
+	}
+	return ret
+}
+
+// InitStates returns the init states of all inputs, sorted by input
+func InitStates() []InitState {
+	initStates.Lock()
+	ret := make([]InitState, 0, len(initStates.m))
+	for _, st := range initStates.m {
+		ret = append(ret, *st)
+	}
+	initStates.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Input != ret[j].Input {
+			return ret[i].Input < ret[j].Input
+		}
+		if ret[i].Provider != ret[j].Provider {
+			return ret[i].Provider < ret[j].Provider
+		}
+		if ret[i].Checksum != ret[j].Checksum {
+			return ret[i].Checksum < ret[j].Checksum
+		}
+		return ret[i].Instance < ret[j].Instance
+	})
+	return ret
+}
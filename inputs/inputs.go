@@ -1,6 +1,9 @@
 package inputs
 
 import (
+	"context"
+	"time"
+
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/types"
 )
@@ -13,6 +16,34 @@ type SampleGatherer interface {
 	Gather(*types.SampleList)
 }
 
+// ContextGatherer is a SampleGatherer giving up once ctx is done, i.e. the gather timed out.
+// Implementations are SampleGatherer as well.
+type ContextGatherer interface {
+	GatherContext(context.Context, *types.SampleList)
+}
+
+type GatherTimeoutGetter interface {
+	GetGatherTimeout() config.Duration
+}
+
+type ScheduleGetter interface {
+	GetCollectionJitter() config.Duration
+	// nil if not set by the input
+	GetRoundInterval() *bool
+}
+
+type TimestampGetter interface {
+	// empty if not set by the input
+	GetPrecision() string
+	// nil if not set by the input
+	GetTickTimestamp() *bool
+}
+
+// TimestampProcessor is Process stamping samples without timestamp with now
+type TimestampProcessor interface {
+	ProcessAt(*types.SampleList, time.Time) *types.SampleList
+}
+
 type Dropper interface {
 	Drop()
 }
@@ -34,6 +65,22 @@ func MayGather(t interface{}, slist *types.SampleList) {
 	}
 }
 
+// MayGatherContext is MayGather, ctx is passed to gatherers supporting it
+func MayGatherContext(ctx context.Context, t interface{}, slist *types.SampleList) {
+	if gather, ok := t.(ContextGatherer); ok {
+		gather.GatherContext(ctx, slist)
+		return
+	}
+	MayGather(t, slist)
+}
+
+func MayGetGatherTimeout(t interface{}) time.Duration {
+	if getter, ok := t.(GatherTimeoutGetter); ok {
+		return time.Duration(getter.GetGatherTimeout())
+	}
+	return 0
+}
+
 func MayDrop(t interface{}) {
 	if dropper, ok := t.(Dropper); ok {
 		dropper.Drop()
@@ -0,0 +1,103 @@
+package inputs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"flashcat.cloud/categraf/config"
+)
+
+type consulBackend struct {
+	clients []*api.Client
+
+	sync.Mutex
+	next int
+}
+
+func newConsulProvider(c *config.ConfigType, op InputOperation) (*KVProvider, error) {
+	if c.ConsulProvider == nil {
+		return nil, fmt.Errorf("consul provider: consul_provider is not configured")
+	}
+	backend, err := newConsulBackend(c.ConsulProvider)
+	if err != nil {
+		return nil, err
+	}
+	return newKVProvider("consul", backend, c.ConsulProvider, op)
+}
+
+func newConsulBackend(c *config.KVProviderConfig) (*consulBackend, error) {
+	endpoints := c.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{"http://127.0.0.1:8500"}
+	}
+	tlsConfig, err := c.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("consul provider: %v", err)
+	}
+
+	b := &consulBackend{}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("consul provider: invalid endpoint %q", endpoint)
+		}
+		conf := api.DefaultConfig()
+		conf.Address = u.Host
+		conf.Scheme = u.Scheme
+		conf.Token = c.Token
+		conf.Datacenter = c.Datacenter
+		if c.Username != "" {
+			conf.HttpAuth = &api.HttpBasicAuth{Username: c.Username, Password: c.Password}
+		}
+		// blocking queries last up to wait time, plus the jitter consul adds
+		conf.HttpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		}
+		client, err := api.NewClient(conf)
+		if err != nil {
+			return nil, fmt.Errorf("consul provider: %v", err)
+		}
+		b.clients = append(b.clients, client)
+	}
+	return b, nil
+}
+
+// list tries the endpoints in turn, starting with the last one that worked
+func (b *consulBackend) list(prefix string, waitIndex uint64, waitTime time.Duration) (map[string][]byte, uint64, error) {
+	// consul keys never start with a slash
+	keyPrefix := strings.TrimPrefix(prefix, "/")
+	var errs []error
+	b.Lock()
+	start := b.next
+	b.Unlock()
+	for i := 0; i < len(b.clients); i++ {
+		client := b.clients[(start+i)%len(b.clients)]
+		pairs, meta, err := client.KV().List(keyPrefix, &api.QueryOptions{
+			WaitIndex: waitIndex,
+			WaitTime:  waitTime,
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b.Lock()
+		b.next = (start + i) % len(b.clients)
+		b.Unlock()
+		kvs := make(map[string][]byte, len(pairs))
+		for _, pair := range pairs {
+			kvs[prefix+strings.TrimPrefix(pair.Key, keyPrefix)] = pair.Value
+		}
+		return kvs, meta.LastIndex, nil
+	}
+	return nil, 0, errors.Join(errs...)
+}
@@ -0,0 +1,277 @@
+package inputs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// etcdBackend talks to the grpc gateway of etcd v3, which serves json over http
+type etcdBackend struct {
+	endpoints []string
+	username  string
+	password  string
+	client    *http.Client
+
+	sync.Mutex
+	next  int
+	token string
+}
+
+type (
+	etcdHeader struct {
+		Revision string `json:"revision"`
+	}
+	etcdKV struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	etcdRangeResponse struct {
+		Header etcdHeader `json:"header"`
+		Kvs    []etcdKV   `json:"kvs"`
+	}
+	etcdWatchResponse struct {
+		Result struct {
+			Created  bool              `json:"created"`
+			Canceled bool              `json:"canceled"`
+			Events   []json.RawMessage `json:"events"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+)
+
+func newEtcdProvider(c *config.ConfigType, op InputOperation) (*KVProvider, error) {
+	if c.EtcdProvider == nil {
+		return nil, fmt.Errorf("etcd provider: etcd_provider is not configured")
+	}
+	backend, err := newEtcdBackend(c.EtcdProvider)
+	if err != nil {
+		return nil, err
+	}
+	return newKVProvider("etcd", backend, c.EtcdProvider, op)
+}
+
+func newEtcdBackend(c *config.KVProviderConfig) (*etcdBackend, error) {
+	tlsConfig, err := c.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("etcd provider: %v", err)
+	}
+	b := &etcdBackend{
+		username: c.Username,
+		password: c.Password,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+	for _, endpoint := range c.Endpoints {
+		b.endpoints = append(b.endpoints, strings.TrimSuffix(endpoint, "/"))
+	}
+	if len(b.endpoints) == 0 {
+		b.endpoints = []string{"http://127.0.0.1:2379"}
+	}
+	return b, nil
+}
+
+// prefixEnd is the range end that selects all keys with prefix
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
+
+func encodeKey(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// list waits for a change under prefix after waitIndex if it's given, then reads the prefix.
+// The index is the revision of etcd, which moves on any change of the whole store.
+func (b *etcdBackend) list(prefix string, waitIndex uint64, waitTime time.Duration) (map[string][]byte, uint64, error) {
+	var errs []error
+	b.Lock()
+	start := b.next
+	b.Unlock()
+	for i := 0; i < len(b.endpoints); i++ {
+		endpoint := b.endpoints[(start+i)%len(b.endpoints)]
+		if waitIndex > 0 {
+			changed, err := b.watch(endpoint, prefix, waitIndex+1, waitTime)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !changed {
+				return nil, waitIndex, nil
+			}
+		}
+		kvs, index, err := b.rangePrefix(endpoint, prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b.Lock()
+		b.next = (start + i) % len(b.endpoints)
+		b.Unlock()
+		return kvs, index, nil
+	}
+	return nil, 0, errors.Join(errs...)
+}
+
+func (b *etcdBackend) rangePrefix(endpoint, prefix string) (map[string][]byte, uint64, error) {
+	body, _ := json.Marshal(map[string]string{
+		"key":       encodeKey(prefix),
+		"range_end": encodeKey(prefixEnd(prefix)),
+	})
+	resp, err := b.post(context.Background(), endpoint, "/v3/kv/range", body)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var rr etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return nil, 0, fmt.Errorf("decode range response of %s: %v", endpoint, err)
+	}
+	revision, err := strconv.ParseUint(rr.Header.Revision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid revision %q from %s", rr.Header.Revision, endpoint)
+	}
+	kvs := make(map[string][]byte, len(rr.Kvs))
+	for _, kv := range rr.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			continue
+		}
+		kvs[string(key)] = value
+	}
+	return kvs, revision, nil
+}
+
+// watch blocks until any key under prefix changed since revision, or waitTime passed
+func (b *etcdBackend) watch(endpoint, prefix string, revision uint64, waitTime time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTime)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            encodeKey(prefix),
+			"range_end":      encodeKey(prefixEnd(prefix)),
+			"start_revision": strconv.FormatUint(revision, 10),
+		},
+	})
+	resp, err := b.post(ctx, endpoint, "/v3/watch", body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var wr etcdWatchResponse
+		if err := dec.Decode(&wr); err != nil {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			return false, fmt.Errorf("watch %s: %v", endpoint, err)
+		}
+		if wr.Error != nil {
+			return false, fmt.Errorf("watch %s: %s", endpoint, wr.Error.Message)
+		}
+		// canceled when revision was compacted, read again to catch up
+		if len(wr.Result.Events) > 0 || wr.Result.Canceled {
+			return true, nil
+		}
+	}
+}
+
+func (b *etcdBackend) post(ctx context.Context, endpoint, path string, body []byte) (*http.Response, error) {
+	token, err := b.authenticate(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		// the token may have expired, authenticate again next time
+		b.Lock()
+		b.token = ""
+		b.Unlock()
+		return nil, fmt.Errorf("request %s%s: status %d: %s", endpoint, path, resp.StatusCode, msg)
+	}
+	return resp, nil
+}
+
+func (b *etcdBackend) authenticate(ctx context.Context, endpoint string) (string, error) {
+	if b.username == "" {
+		return "", nil
+	}
+	b.Lock()
+	token := b.token
+	b.Unlock()
+	if token != "" {
+		return token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"name": b.username, "password": b.password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/auth/authenticate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("authenticate to %s: status %d", endpoint, resp.StatusCode)
+	}
+	var ar struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return "", fmt.Errorf("decode authenticate response of %s: %v", endpoint, err)
+	}
+	b.Lock()
+	b.token = ar.Token
+	b.Unlock()
+	return ar.Token, nil
+}
@@ -0,0 +1,258 @@
+package inputs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/backoff"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+const defaultKVWaitTime = 5 * time.Minute
+
+// kvBackend reads keys from a kv store
+type kvBackend interface {
+	// list returns the key-values under prefix and the index of the read. With waitIndex
+	// greater than 0 it blocks until something under prefix changed after waitIndex,
+	// or waitTime passed.
+	list(prefix string, waitIndex uint64, waitTime time.Duration) (map[string][]byte, uint64, error)
+}
+
+// KVProvider reads input configs from a kv store, every key <prefix>/input.<name>/<file>
+// is an instance of input <name>. Changes are picked up with blocking queries, only the
+// configs that changed are registered or deregistered, by checksum like HTTPProvider.
+type KVProvider struct {
+	sync.RWMutex
+
+	name     string
+	backend  kvBackend
+	prefixes []string
+	waitTime time.Duration
+	op       InputOperation
+
+	// prefix -> key -> value, and the index of the last read
+	snapshots map[string]map[string][]byte
+	indexes   map[string]uint64
+
+	configMap map[string]map[string]*cfg.ConfigWithFormat
+	cache     *innerCache
+
+	stopCh chan struct{}
+}
+
+func newKVProvider(name string, backend kvBackend, c *config.KVProviderConfig, op InputOperation) (*KVProvider, error) {
+	if len(c.Prefixes) == 0 {
+		return nil, fmt.Errorf("%s provider: prefixes is empty", name)
+	}
+	kp := &KVProvider{
+		name:      name,
+		backend:   backend,
+		waitTime:  time.Duration(c.WaitTime),
+		op:        op,
+		snapshots: make(map[string]map[string][]byte),
+		indexes:   make(map[string]uint64),
+		cache:     newInnerCache(),
+	}
+	if kp.waitTime <= 0 {
+		kp.waitTime = defaultKVWaitTime
+	}
+	for _, p := range c.Prefixes {
+		kp.prefixes = append(kp.prefixes, strings.TrimSuffix(expandPrefix(p), "/")+"/")
+	}
+	return kp, nil
+}
+
+// expandPrefix scopes a prefix to this host, ${labels.<name>} refers to global labels
+func expandPrefix(prefix string) string {
+	if !strings.Contains(prefix, "$") {
+		return prefix
+	}
+	for k, v := range config.GlobalLabels() {
+		prefix = strings.ReplaceAll(prefix, "${labels."+k+"}", v)
+	}
+	return config.Expand(prefix)
+}
+
+func (kp *KVProvider) Name() string {
+	return kp.name
+}
+
+// LoadConfig reads all prefixes without blocking
+func (kp *KVProvider) LoadConfig() (bool, error) {
+	var errs []error
+	for _, prefix := range kp.prefixes {
+		kvs, index, err := kp.backend.list(prefix, 0, kp.waitTime)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s provider: failed to read %s: %v", kp.name, prefix, err))
+			continue
+		}
+		kp.Lock()
+		kp.snapshots[prefix] = kvs
+		kp.indexes[prefix] = index
+		kp.Unlock()
+	}
+	add, del := kp.update()
+	return add.len()+del.len() > 0, errors.Join(errs...)
+}
+
+// update rebuilds the configs from snapshots, it returns the configs added and deleted
+func (kp *KVProvider) update() (add, del *innerCache) {
+	kp.Lock()
+	defer kp.Unlock()
+
+	configMap := make(map[string]map[string]*cfg.ConfigWithFormat)
+	for prefix, kvs := range kp.snapshots {
+		for key, value := range kvs {
+			inputKey, format, ok := parseKVKey(strings.TrimPrefix(key, prefix))
+			if !ok || len(value) == 0 {
+				continue
+			}
+			sum := md5.Sum(value)
+			c := &cfg.ConfigWithFormat{Config: string(value), Format: format, Source: key}
+			c.SetCheckSum(hex.EncodeToString(sum[:]))
+			if configMap[inputKey] == nil {
+				configMap[inputKey] = make(map[string]*cfg.ConfigWithFormat)
+			}
+			configMap[inputKey][c.CheckSum()] = c
+		}
+	}
+
+	var cache *innerCache
+	add, del, cache = calculateDiff(kp.cache, configMap)
+	kp.cache = cache
+	kp.configMap = configMap
+	return add, del
+}
+
+// parseKVKey accepts input.<name>/<file> and input.<name>, the format is guessed by the file suffix
+func parseKVKey(key string) (string, cfg.ConfigFormat, bool) {
+	if !strings.HasPrefix(key, inputFilePrefix) {
+		return "", "", false
+	}
+	dir, file, _ := strings.Cut(key, "/")
+	inputKey := strings.ToLower(strings.TrimPrefix(dir, inputFilePrefix))
+	if inputKey == "" || strings.Contains(file, "/") {
+		return "", "", false
+	}
+	return inputKey, cfg.GuessFormat(file), true
+}
+
+func (kp *KVProvider) StartReloader() {
+	kp.stopCh = make(chan struct{})
+	for _, prefix := range kp.prefixes {
+		go kp.watch(prefix, kp.stopCh)
+	}
+}
+
+func (kp *KVProvider) StopReloader() {
+	if kp.stopCh != nil {
+		close(kp.stopCh)
+		kp.stopCh = nil
+	}
+}
+
+func (kp *KVProvider) watch(prefix string, stopCh chan struct{}) {
+	policy := backoff.NewPolicy(2, 1, 60, 2, false)
+	numErrors := 0
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		kp.RLock()
+		index := kp.indexes[prefix]
+		kp.RUnlock()
+
+		kvs, newIndex, err := kp.backend.list(prefix, index, kp.waitTime)
+		if err != nil {
+			numErrors = policy.IncError(numErrors)
+			wait := policy.GetBackoffDuration(numErrors)
+			log.Printf("W! %s provider: failed to watch %s: %v, retry after %s", kp.name, prefix, err, wait)
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+		numErrors = policy.DecError(numErrors)
+
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		// the index may go backwards when the kv store is restored, read from scratch then
+		if newIndex < index {
+			newIndex = 0
+		}
+		if newIndex == index {
+			continue
+		}
+
+		kp.Lock()
+		kp.snapshots[prefix] = kvs
+		kp.indexes[prefix] = newIndex
+		kp.Unlock()
+		kp.apply(kp.update())
+	}
+}
+
+// apply registers the new or updated configs and deregisters the deleted ones
+func (kp *KVProvider) apply(add, del *innerCache) {
+	if add.len() > 0 {
+		log.Printf("I! %s provider: new or updated inputs: %v", kp.name, add)
+		for inputKey, cm := range add.iter() {
+			for _, conf := range cm {
+				kp.op.RegisterInput(FormatInputName(kp.Name(), inputKey), []cfg.ConfigWithFormat{conf})
+			}
+		}
+	}
+	if del.len() > 0 {
+		log.Printf("I! %s provider: deleted inputs: %v", kp.name, del)
+		for inputKey, cm := range del.iter() {
+			for sum := range cm {
+				kp.op.DeregisterInput(FormatInputName(kp.Name(), inputKey), sum)
+			}
+		}
+	}
+}
+
+func (kp *KVProvider) GetInputs() ([]string, error) {
+	kp.RLock()
+	defer kp.RUnlock()
+
+	inputs := make([]string, 0, len(kp.configMap))
+	for k := range kp.configMap {
+		inputs = append(inputs, k)
+	}
+	return inputs, nil
+}
+
+func (kp *KVProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat, error) {
+	kp.RLock()
+	defer kp.RUnlock()
+
+	configs, has := kp.configMap[inputKey]
+	if !has {
+		return nil, nil
+	}
+	cfgs := make([]cfg.ConfigWithFormat, 0, len(configs))
+	for _, v := range configs {
+		cfgs = append(cfgs, *v)
+	}
+	return cfgs, nil
+}
+
+func (kp *KVProvider) LoadInputConfig(configs []cfg.ConfigWithFormat, input Input) (map[string]Input, error) {
+	return loadInputConfigs(configs, input)
+}
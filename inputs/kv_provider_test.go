@@ -0,0 +1,203 @@
+package inputs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// kvStore is the data of the stand-in consul and etcd servers
+type kvStore struct {
+	sync.Mutex
+	data    map[string]string
+	index   uint64
+	changed chan struct{}
+}
+
+func newKVStore() *kvStore {
+	return &kvStore{data: make(map[string]string), index: 1, changed: make(chan struct{})}
+}
+
+func (s *kvStore) set(key, value string) {
+	s.Lock()
+	defer s.Unlock()
+	if value == "" {
+		delete(s.data, key)
+	} else {
+		s.data[key] = value
+	}
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *kvStore) list(prefix string) (map[string]string, uint64, chan struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	kvs := make(map[string]string)
+	for k, v := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			kvs[k] = v
+		}
+	}
+	return kvs, s.index, s.changed
+}
+
+func consulServer(t *testing.T, store *kvStore) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		kvs, index, changed := store.list(prefix)
+		if wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); wait > 0 && wait >= index {
+			select {
+			case <-changed:
+			case <-time.After(time.Second):
+			}
+			kvs, index, _ = store.list(prefix)
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		if len(kvs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pairs := make([]map[string]interface{}, 0, len(kvs))
+		for k, v := range kvs {
+			pairs = append(pairs, map[string]interface{}{"Key": k, "Value": []byte(v)})
+		}
+		json.NewEncoder(w).Encode(pairs)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func decodeB64(t *testing.T, s string) string {
+	b, err := base64.StdEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func etcdServer(t *testing.T, store *kvStore) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			kvs, index, _ := store.list(decodeB64(t, req["key"]))
+			resp := etcdRangeResponse{Header: etcdHeader{Revision: strconv.FormatUint(index, 10)}}
+			for k, v := range kvs {
+				resp.Kvs = append(resp.Kvs, etcdKV{Key: encodeKey(k), Value: encodeKey(v)})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/v3/watch":
+			var req struct {
+				CreateRequest struct {
+					Key           string `json:"key"`
+					StartRevision string `json:"start_revision"`
+				} `json:"create_request"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			start, _ := strconv.ParseUint(req.CreateRequest.StartRevision, 10, 64)
+			w.Write([]byte(`{"result":{"created":true}}`))
+			w.(http.Flusher).Flush()
+			_, index, changed := store.list(decodeB64(t, req.CreateRequest.Key))
+			if start > index {
+				select {
+				case <-changed:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			w.Write([]byte(`{"result":{"events":[{"type":"PUT"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testKVProvider(t *testing.T, kp *KVProvider, store *kvStore, prefix string, op *recordOperation) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	changed, err := kp.LoadConfig()
+	require.NoError(t, err)
+	require.True(t, changed)
+	inputs, _ := kp.GetInputs()
+	sort.Strings(inputs)
+	require.Equal(t, []string{"cpu", "mem"}, inputs)
+	configs, _ := kp.GetInputConfig("cpu")
+	require.Len(t, configs, 2)
+
+	kp.StartReloader()
+	defer kp.StopReloader()
+
+	store.set(prefix+"input.cpu/a.toml", "interval = 30")
+	store.set(prefix+"input.mem/mem.toml", "")
+	store.set(prefix+"input.net/net.json", `{"interval": 15}`)
+	store.set("other/input.disk/disk.toml", "interval = 15")
+
+	registered := []string{kp.name + ".cpu", kp.name + ".net"}
+	deregistered := []string{kp.name + ".cpu", kp.name + ".mem"}
+	require.Eventually(t, func() bool {
+		r, d := op.names()
+		return len(r) >= 2 && len(d) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	r, d := op.names()
+	require.Equal(t, registered, r)
+	require.Equal(t, deregistered, d)
+
+	inputs, _ = kp.GetInputs()
+	sort.Strings(inputs)
+	require.Equal(t, []string{"cpu", "net"}, inputs)
+}
+
+func TestConsulProvider(t *testing.T) {
+	store := newKVStore()
+	store.set("categraf/web01/input.cpu/a.toml", "interval = 15")
+	store.set("categraf/web01/input.cpu/b.toml", "interval = 60")
+	store.set("categraf/web01/input.mem/mem.toml", "interval = 15")
+	store.set("categraf/web01/readme", "not an input")
+	srv := consulServer(t, store)
+
+	op := &recordOperation{}
+	kp, err := newConsulProvider(&config.ConfigType{ConsulProvider: &config.KVProviderConfig{
+		Endpoints: []string{"http://127.0.0.1:1", srv.URL},
+		Prefixes:  []string{"/categraf/web01"},
+		WaitTime:  config.Duration(time.Second),
+	}}, op)
+	require.NoError(t, err)
+	testKVProvider(t, kp, store, "categraf/web01/", op)
+}
+
+func TestEtcdProvider(t *testing.T) {
+	store := newKVStore()
+	store.set("/categraf/web01/input.cpu/a.toml", "interval = 15")
+	store.set("/categraf/web01/input.cpu/b.toml", "interval = 60")
+	store.set("/categraf/web01/input.mem/mem.toml", "interval = 15")
+	srv := etcdServer(t, store)
+
+	op := &recordOperation{}
+	kp, err := newEtcdProvider(&config.ConfigType{EtcdProvider: &config.KVProviderConfig{
+		Endpoints: []string{srv.URL},
+		Prefixes:  []string{"/categraf/web01/"},
+		WaitTime:  config.Duration(time.Second),
+	}}, op)
+	require.NoError(t, err)
+	testKVProvider(t, kp, store, "/categraf/web01/", op)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	require.Equal(t, "/categraf0", prefixEnd("/categraf/"))
+	require.Equal(t, "a\x01", prefixEnd("a\x00\xff"))
+}
@@ -2,57 +2,243 @@ package inputs
 
 import (
 	"fmt"
+	"log"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/toolkits/pkg/file"
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/pkg/cfg"
+	"flashcat.cloud/categraf/pkg/checksum"
 	"flashcat.cloud/categraf/pkg/choice"
 )
 
+const (
+	defaultPollInterval = 10 * time.Second
+	// wait for editors to finish writing before reloading
+	watchDebounce = time.Second
+)
+
 type LocalProvider struct {
 	sync.RWMutex
 
 	configDir  string
 	inputNames []string
+
+	watch        bool
+	pollInterval time.Duration
+	op           InputOperation
+	// inputKey -> checksum of its config files
+	sums   map[string]string
+	stopCh chan struct{}
 }
 
-func newLocalProvider(c *config.ConfigType) (*LocalProvider, error) {
-	return &LocalProvider{
-		configDir: c.ConfigDir,
-	}, nil
+func newLocalProvider(c *config.ConfigType, op InputOperation) (*LocalProvider, error) {
+	lp := &LocalProvider{
+		configDir:    c.ConfigDir,
+		op:           op,
+		pollInterval: defaultPollInterval,
+	}
+	if lpc := c.LocalProviderConfig; lpc != nil {
+		lp.watch = lpc.Watch
+		if lpc.PollInterval > 0 {
+			lp.pollInterval = time.Duration(lpc.PollInterval)
+		}
+	}
+	return lp, nil
 }
 
 func (lp *LocalProvider) Name() string {
 	return "local"
 }
 
-// StartReloader 内部可以检查是否有配置的变更,如果有变更,则可以手动执行reloadFunc来重启插件
-func (lp *LocalProvider) StartReloader() {}
+// StartReloader watches conf/input.* if [local_provider] watch is on, only the
+// inputs whose files changed are restarted
+func (lp *LocalProvider) StartReloader() {
+	if !lp.watch {
+		return
+	}
+	lp.stopCh = make(chan struct{})
+
+	watcher, err := lp.newWatcher()
+	if err != nil {
+		log.Printf("W! local provider: failed to watch %s: %v, poll every %s instead", lp.configDir, err, lp.pollInterval)
+		go lp.poll(lp.stopCh)
+		return
+	}
+	go lp.watchLoop(watcher, lp.stopCh)
+}
 
-func (lp *LocalProvider) StopReloader() {}
+func (lp *LocalProvider) StopReloader() {
+	if lp.stopCh != nil {
+		close(lp.stopCh)
+		lp.stopCh = nil
+	}
+}
 
+func (lp *LocalProvider) newWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(lp.configDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	for _, name := range lp.inputDirs() {
+		if err := watcher.Add(path.Join(lp.configDir, inputFilePrefix+name)); err != nil {
+			log.Println("W! local provider: failed to watch input", name, "error:", err)
+		}
+	}
+	return watcher, nil
+}
+
+func (lp *LocalProvider) watchLoop(watcher *fsnotify.Watcher, stopCh chan struct{}) {
+	defer watcher.Close()
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// new input dirs are watched as well
+			if ev.Has(fsnotify.Create) && filepath.Dir(ev.Name) == filepath.Clean(lp.configDir) &&
+				strings.HasPrefix(filepath.Base(ev.Name), inputFilePrefix) {
+				if err := watcher.Add(ev.Name); err != nil {
+					log.Println("W! local provider: failed to watch", ev.Name, "error:", err)
+				}
+			}
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("W! local provider: watch error:", err)
+		case <-timer.C:
+			lp.reload()
+		}
+	}
+}
+
+func (lp *LocalProvider) poll(stopCh chan struct{}) {
+	ticker := time.NewTicker(lp.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			lp.reload()
+		}
+	}
+}
+
+// reload compares the checksums of conf/input.* with the last load, and
+// registers or deregisters the inputs that changed
+func (lp *LocalProvider) reload() {
+	lp.RLock()
+	old := lp.sums
+	lp.RUnlock()
+
+	if _, err := lp.LoadConfig(); err != nil {
+		log.Println("E! local provider: failed to reload configs:", err)
+		return
+	}
+
+	lp.RLock()
+	sums := lp.sums
+	lp.RUnlock()
+
+	for inputKey, sum := range sums {
+		oldSum, has := old[inputKey]
+		if has && oldSum == sum {
+			continue
+		}
+		name := FormatInputName(lp.Name(), inputKey)
+		if has {
+			log.Println("I! local provider: input changed:", inputKey)
+			lp.op.DeregisterInput(name, "")
+		} else {
+			log.Println("I! local provider: new input:", inputKey)
+		}
+		configs, err := lp.GetInputConfig(inputKey)
+		if err != nil {
+			log.Println("E! local provider: failed to get configuration of input:", inputKey, "error:", err)
+			continue
+		}
+		lp.op.RegisterInput(name, configs)
+	}
+
+	for inputKey := range old {
+		if _, has := sums[inputKey]; !has {
+			log.Println("I! local provider: input deleted:", inputKey)
+			lp.op.DeregisterInput(FormatInputName(lp.Name(), inputKey), "")
+		}
+	}
+}
+
+func (lp *LocalProvider) inputDirs() []string {
+	lp.RLock()
+	defer lp.RUnlock()
+	return append([]string(nil), lp.inputNames...)
+}
+
+// LoadConfig scans conf/input.*, it reports whether any input changed since the last scan
 func (lp *LocalProvider) LoadConfig() (bool, error) {
 	dirs, err := file.DirsUnder(lp.configDir)
 	if err != nil {
 		return false, fmt.Errorf("failed to get dirs under %s : %v", config.Config.ConfigDir, err)
 	}
 
+	lp.RLock()
+	prev := lp.sums
+	lp.RUnlock()
+
 	names := make([]string, 0, len(dirs))
+	sums := make(map[string]string, len(dirs))
 	for _, dir := range dirs {
-		if strings.HasPrefix(dir, inputFilePrefix) {
-			names = append(names, dir[len(inputFilePrefix):])
+		if !strings.HasPrefix(dir, inputFilePrefix) {
+			continue
 		}
+		name := dir[len(inputFilePrefix):]
+		names = append(names, name)
+
+		configs, err := lp.readInputConfig(name)
+		if err != nil {
+			log.Println("W! local provider: failed to read configuration of input:", name, "error:", err)
+			// the input keeps running with the configs read last time, it is not taken as deleted
+			if sum, has := prev[name]; has {
+				sums[name] = sum
+			}
+			continue
+		}
+		sums[name] = fmt.Sprint(checksum.New(configs))
 	}
 
 	lp.Lock()
+	changed := len(sums) != len(lp.sums)
+	for name, sum := range sums {
+		if lp.sums[name] != sum {
+			changed = true
+		}
+	}
 	lp.inputNames = names
+	lp.sums = sums
 	lp.Unlock()
 
-	return false, nil
+	return changed, nil
 }
 
 func (lp *LocalProvider) GetInputs() ([]string, error) {
@@ -73,6 +259,10 @@ func (lp *LocalProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat
 	}
 	lp.RUnlock()
 
+	return lp.readInputConfig(inputKey)
+}
+
+func (lp *LocalProvider) readInputConfig(inputKey string) ([]cfg.ConfigWithFormat, error) {
 	files, err := file.FilesUnder(path.Join(lp.configDir, inputFilePrefix+inputKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files under: %s : %v", lp.configDir, err)
@@ -93,6 +283,7 @@ func (lp *LocalProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat
 		cwf = append(cwf, cfg.ConfigWithFormat{
 			Config: string(c),
 			Format: cfg.GuessFormat(f),
+			Source: path.Join(lp.configDir, inputFilePrefix+inputKey, f),
 		})
 	}
 
@@ -0,0 +1,100 @@
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+type recordOperation struct {
+	sync.Mutex
+	registered   []string
+	deregistered []string
+}
+
+func (ro *recordOperation) RegisterInput(name string, _ []cfg.ConfigWithFormat) {
+	ro.Lock()
+	defer ro.Unlock()
+	ro.registered = append(ro.registered, name)
+}
+
+func (ro *recordOperation) DeregisterInput(name string, _ string) {
+	ro.Lock()
+	defer ro.Unlock()
+	ro.deregistered = append(ro.deregistered, name)
+}
+
+// names returns sorted copies of the registered and deregistered inputs
+func (ro *recordOperation) names() ([]string, []string) {
+	ro.Lock()
+	defer ro.Unlock()
+	registered := append([]string(nil), ro.registered...)
+	deregistered := append([]string(nil), ro.deregistered...)
+	sort.Strings(registered)
+	sort.Strings(deregistered)
+	return registered, deregistered
+}
+
+func writeInputConfig(t *testing.T, dir, input, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, inputFilePrefix+input), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, inputFilePrefix+input, input+".toml"), []byte(content), 0o644))
+}
+
+func TestLocalProviderReloadChangedInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeInputConfig(t, dir, "cpu", "interval = 15")
+	writeInputConfig(t, dir, "mem", "interval = 15")
+	writeInputConfig(t, dir, "disk", "interval = 15")
+
+	op := &recordOperation{}
+	lp, err := newLocalProvider(&config.ConfigType{ConfigDir: dir}, op)
+	require.NoError(t, err)
+	_, err = lp.LoadConfig()
+	require.NoError(t, err)
+
+	// nothing changed
+	lp.reload()
+	require.Empty(t, op.registered)
+	require.Empty(t, op.deregistered)
+
+	writeInputConfig(t, dir, "cpu", "interval = 30")
+	writeInputConfig(t, dir, "net", "interval = 15")
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, inputFilePrefix+"disk")))
+	lp.reload()
+
+	sort.Strings(op.registered)
+	sort.Strings(op.deregistered)
+	require.Equal(t, []string{"local.cpu", "local.net"}, op.registered)
+	require.Equal(t, []string{"local.cpu", "local.disk"}, op.deregistered)
+}
+
+func TestLocalProviderReloadReadError(t *testing.T) {
+	dir := t.TempDir()
+	writeInputConfig(t, dir, "cpu", "interval = 15")
+
+	op := &recordOperation{}
+	lp, err := newLocalProvider(&config.ConfigType{ConfigDir: dir}, op)
+	require.NoError(t, err)
+	_, err = lp.LoadConfig()
+	require.NoError(t, err)
+
+	// a dangling link fails to read, the input is neither changed nor deleted
+	broken := filepath.Join(dir, inputFilePrefix+"cpu", "broken.toml")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing"), broken))
+	lp.reload()
+	require.Empty(t, op.registered)
+	require.Empty(t, op.deregistered)
+
+	require.NoError(t, os.Remove(broken))
+	writeInputConfig(t, dir, "cpu", "interval = 30")
+	lp.reload()
+	require.Equal(t, []string{"local.cpu"}, op.registered)
+	require.Equal(t, []string{"local.cpu"}, op.deregistered)
+}
@@ -167,6 +167,11 @@ func (p *Prometheus) Drop() {
 }
 
 func (ins *Instance) Gather(slist *types.SampleList) {
+	ins.GatherContext(context.Background(), slist)
+}
+
+// GatherContext scrapes the urls, the requests are canceled once ctx is done
+func (ins *Instance) GatherContext(ctx context.Context, slist *types.SampleList) {
 	urlwg := new(sync.WaitGroup)
 	defer urlwg.Wait()
 
@@ -179,7 +184,7 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 
 		urlwg.Add(1)
 
-		go ins.gatherUrl(urlwg, slist, &ScrapeUrl{URL: u, Tags: map[string]string{}})
+		go ins.gatherUrl(ctx, urlwg, slist, &ScrapeUrl{URL: u, Tags: map[string]string{}})
 	}
 
 	urls, err := ins.UrlsFromConsul()
@@ -190,11 +195,11 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 
 	for i := 0; i < len(urls); i++ {
 		urlwg.Add(1)
-		go ins.gatherUrl(urlwg, slist, urls[i])
+		go ins.gatherUrl(ctx, urlwg, slist, urls[i])
 	}
 }
 
-func (ins *Instance) gatherUrl(urlwg *sync.WaitGroup, slist *types.SampleList, uri *ScrapeUrl) {
+func (ins *Instance) gatherUrl(ctx context.Context, urlwg *sync.WaitGroup, slist *types.SampleList, uri *ScrapeUrl) {
 	defer urlwg.Done()
 
 	u := uri.URL
@@ -203,7 +208,7 @@ func (ins *Instance) gatherUrl(urlwg *sync.WaitGroup, slist *types.SampleList, u
 		u.Path = "/metrics"
 	}
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		log.Println("E! failed to new request for url:", u.String(), "error:", err)
 		return
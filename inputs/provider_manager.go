@@ -80,8 +80,20 @@ func NewProvider(c *config.ConfigType, op InputOperation) ([]Provider, error) {
 				return nil, err
 			}
 			providers = append(providers, provider)
+		case "consul":
+			provider, err := newConsulProvider(c, op)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, provider)
+		case "etcd":
+			provider, err := newEtcdProvider(c, op)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, provider)
 		case "local":
-			provider, err := newLocalProvider(c)
+			provider, err := newLocalProvider(c, op)
 			if err != nil {
 				return nil, err
 			}
@@ -53,6 +53,73 @@ func (ins *Categraf) Gather(slist *types.SampleList) {
 	slist.PushSample(defaultPrefix, "metrics_enqueue_failed_sum", ss.FailTotal, vTag)
 	slist.PushSample(defaultPrefix, "metrics_enqueue_failed_count", ss.FailCount, vTag)
 	slist.PushSample(defaultPrefix, "current_queue_size", ss.QueueSize, vTag)
+	if db := config.Config.WriterOpt.DiskBuffer; db != nil && db.Enable {
+		slist.PushSample(defaultPrefix, "disk_queue_size", ss.DiskQueueSize, vTag)
+		slist.PushSample(defaultPrefix, "disk_queue_bytes", ss.DiskQueueBytes, vTag)
+		slist.PushSample(defaultPrefix, "disk_queue_spilled_sum", ss.DiskSpillTotal, vTag)
+		slist.PushSample(defaultPrefix, "disk_queue_replayed_sum", ss.DiskReplayTotal, vTag)
+		slist.PushSample(defaultPrefix, "disk_queue_dropped_sum", ss.DiskDropTotal, vTag)
+	}
+	for _, ws := range ss.Writers {
+		wTag := map[string]string{
+			"version": config.Version,
+			"writer":  ws.Name,
+		}
+		slist.PushSample(defaultPrefix, "writer_success_sum", ws.SuccessTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_failed_sum", ws.FailTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_dropped_sum", ws.DropTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_retry_count", ws.RetryCount, wTag)
+		slist.PushSample(defaultPrefix, "writer_queue_size", ws.QueueSize, wTag)
+	}
+
+	for input, dropped := range ss.SeriesDropped {
+		slist.PushSample(defaultPrefix, "series_dropped_total", dropped, map[string]string{
+			"version": config.Version,
+			"input":   input,
+		})
+	}
+
+	// series pushed to the http api, and those rejected with 503 as the queue was full
+	for route, n := range ss.PushTotal {
+		slist.PushSample(defaultPrefix, "push_series_total", n, map[string]string{
+			"version": config.Version,
+			"route":   route,
+		})
+	}
+	for route, n := range ss.PushRejected {
+		slist.PushSample(defaultPrefix, "push_series_rejected_total", n, map[string]string{
+			"version": config.Version,
+			"route":   route,
+		})
+	}
+
+	// init state of inputs and instances, failed ones are retried in background
+	for _, st := range inputs.InitStates() {
+		up := 0
+		if st.Up {
+			up = 1
+		}
+		slist.PushSample(defaultPrefix, "input_up", up, map[string]string{
+			"version":  config.Version,
+			"input":    st.Input,
+			"provider": st.Provider,
+			"checksum": st.Checksum,
+			"index":    st.Instance,
+		})
+	}
+
+	// gathers abandoned after gather_timeout, and rounds skipped as they were still running
+	for _, c := range inputs.GatherCounters() {
+		gTag := map[string]string{
+			"version":  config.Version,
+			"input":    c.Input,
+			"provider": c.Provider,
+			"checksum": c.Checksum,
+			"index":    c.Instance,
+		}
+		slist.PushSample(defaultPrefix, "gather_timeouts_total", c.Timeouts, gTag)
+		slist.PushSample(defaultPrefix, "gather_skipped_total", c.Skipped, gTag)
+	}
 
 	for _, mf := range mfs {
 		metricName := mf.GetName()
@@ -0,0 +1,173 @@
+package statsd
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// metric is a value of a line of statsd, <name>:<value>[:<value>...]|<type>[|@<sample rate>][|#<tag>:<value>,...],
+// several values sharing the type and tags are a dogstatsd extension
+type metric struct {
+	name   string
+	labels map[string]string
+	// c, g, ms or s, h and d of dogstatsd are timings as well
+	typ   string
+	value float64
+	// raw value of sets
+	member string
+	rate   float64
+	// gauge value prefixed with + or -, added to the current value
+	delta bool
+}
+
+// parseLine returns the metrics of line, nil for events and service checks of dogstatsd
+func parseLine(line string) ([]metric, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, nil
+	}
+
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("no type: %s", line)
+	}
+	name, values, ok := strings.Cut(parts[0], ":")
+	if !ok || name == "" || values == "" {
+		return nil, fmt.Errorf("no name or value: %s", line)
+	}
+
+	typ := parts[1]
+	switch typ {
+	case "c", "g", "ms", "s":
+	case "h", "d":
+		typ = "ms"
+	default:
+		return nil, fmt.Errorf("unsupported type %q: %s", typ, line)
+	}
+
+	rate := 1.0
+	var labels map[string]string
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			r, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q: %s", part, line)
+			}
+			rate = r
+		case strings.HasPrefix(part, "#"):
+			labels = parseTags(part[1:])
+		}
+		// container id (c:) and timestamp (T) of dogstatsd are ignored
+	}
+
+	var ms []metric
+	for _, v := range strings.Split(values, ":") {
+		m := metric{name: name, labels: labels, typ: typ, rate: rate}
+		if typ == "s" {
+			m.member = v
+		} else {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q: %s", v, line)
+			}
+			m.value = f
+			m.delta = typ == "g" && (v[0] == '+' || v[0] == '-')
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// parseTags parses tags of dogstatsd, a tag without value is "true"
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(tag, ":")
+		if k == "" {
+			continue
+		}
+		if !ok {
+			v = "true"
+		}
+		tags[k] = v
+	}
+	return tags
+}
+
+// template maps the dot separated parts of a metric name to the name and labels. "measurement"
+// parts make up the name, "measurement*" all the remaining parts, other words are labels and
+// empty ones are skipped, e.g. "measurement.measurement.region" turns "cpu.load.us-west" into
+// cpu_load{region="us-west"}. filter is a dot separated glob limiting the names the template
+// applies to, as a prefix of them.
+type template struct {
+	filter []string
+	parts  []string
+}
+
+// parseTemplate parses "[filter ]template"
+func parseTemplate(s string) (*template, error) {
+	fields := strings.Fields(s)
+	t := &template{}
+	switch len(fields) {
+	case 1:
+		t.parts = strings.Split(fields[0], ".")
+	case 2:
+		t.filter = strings.Split(fields[0], ".")
+		for _, f := range t.filter {
+			if _, err := path.Match(f, ""); err != nil {
+				return nil, fmt.Errorf("invalid filter of template %q: %v", s, err)
+			}
+		}
+		t.parts = strings.Split(fields[1], ".")
+	default:
+		return nil, fmt.Errorf("invalid template %q", s)
+	}
+	return t, nil
+}
+
+func (t *template) match(parts []string) bool {
+	if len(parts) < len(t.filter) {
+		return false
+	}
+	for i, f := range t.filter {
+		if ok, _ := path.Match(f, parts[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the name and labels of parts, the parts beyond the template are dropped
+func (t *template) apply(parts []string) (string, map[string]string) {
+	var names []string
+	labels := make(map[string]string)
+	for i := 0; i < len(t.parts) && i < len(parts); i++ {
+		switch p := t.parts[i]; p {
+		case "":
+		case "measurement":
+			names = append(names, parts[i])
+		case "measurement*":
+			names = append(names, parts[i:]...)
+			i = len(parts)
+		default:
+			labels[p] = parts[i]
+		}
+	}
+	if len(names) == 0 {
+		return strings.Join(parts, "_"), labels
+	}
+	return strings.Join(names, "_"), labels
+}
+
+// applyTemplates applies the first template matching name, name is kept if none matches
+func applyTemplates(templates []*template, name string) (string, map[string]string) {
+	parts := strings.Split(name, ".")
+	for _, t := range templates {
+		if t.match(parts) {
+			return t.apply(parts)
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,433 @@
+package statsd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	inputName = "statsd"
+
+	// max size of a udp packet
+	udpPacketSize = 64 * 1024
+)
+
+// Statsd listens for statsd and dogstatsd metrics and aggregates them between two gathers,
+// i.e. the flush interval is the interval of the input.
+type Statsd struct {
+	config.PluginConfig
+
+	// udp, udp4, udp6, tcp, tcp4, tcp6 or unixgram
+	Protocol string `toml:"protocol"`
+	// host:port, the socket path for unixgram. statsd is disabled if empty
+	ServiceAddress    string `toml:"service_address"`
+	MaxTCPConnections int    `toml:"max_tcp_connections"`
+	// receive buffer of the socket, the default of the os if 0
+	ReadBufferSize int `toml:"read_buffer_size"`
+
+	// percentiles of timings, 0 to 100
+	Percentiles []float64 `toml:"percentiles"`
+	// max values of a timing kept for percentiles per flush, sampled beyond it
+	PercentileLimit int `toml:"percentile_limit"`
+	// counters and gauges keep their value across flushes unless deleted
+	DeleteCounters bool `toml:"delete_counters"`
+	DeleteGauges   bool `toml:"delete_gauges"`
+
+	Templates []string `toml:"templates"`
+
+	templates []*template
+
+	lock     sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	sets     map[string]*set
+	timings  map[string]*timing
+
+	listener   net.Listener
+	packetConn net.PacketConn
+	conns      map[net.Conn]struct{}
+	connsLock  sync.Mutex
+	wg         sync.WaitGroup
+}
+
+type series struct {
+	name   string
+	labels map[string]string
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value float64
+}
+
+type set struct {
+	series
+	members map[string]struct{}
+}
+
+type timing struct {
+	series
+	// weighted by sample rate
+	count float64
+	sum   float64
+	// observed values, sampled beyond percentile_limit
+	values []float64
+	seen   int
+	lower  float64
+	upper  float64
+	// of observed values, for stddev
+	mean float64
+	m2   float64
+}
+
+func init() {
+	inputs.Add(inputName, func() inputs.Input {
+		return &Statsd{}
+	})
+}
+
+func (s *Statsd) Clone() inputs.Input {
+	return &Statsd{}
+}
+
+func (s *Statsd) Name() string {
+	return inputName
+}
+
+func (s *Statsd) Init() error {
+	if s.Protocol == "" {
+		s.Protocol = "udp"
+	}
+	// nothing listens unless asked to
+	if s.ServiceAddress == "" {
+		return types.ErrInstancesEmpty
+	}
+	if s.MaxTCPConnections <= 0 {
+		s.MaxTCPConnections = 250
+	}
+	if len(s.Percentiles) == 0 {
+		s.Percentiles = []float64{90}
+	}
+	for _, p := range s.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("invalid percentile %v, should be in (0, 100]", p)
+		}
+	}
+	if s.PercentileLimit <= 0 {
+		s.PercentileLimit = 1000
+	}
+	for _, t := range s.Templates {
+		tmpl, err := parseTemplate(t)
+		if err != nil {
+			return err
+		}
+		s.templates = append(s.templates, tmpl)
+	}
+
+	s.counters = make(map[string]*counter)
+	s.gauges = make(map[string]*gauge)
+	s.sets = make(map[string]*set)
+	s.timings = make(map[string]*timing)
+	s.conns = make(map[net.Conn]struct{})
+	return nil
+}
+
+// Start listens on service_address, the metrics received are flushed by Gather
+func (s *Statsd) Start(_ *types.SampleList) error {
+	switch s.Protocol {
+	case "udp", "udp4", "udp6", "unixgram":
+		if s.Protocol == "unixgram" {
+			// a socket left by the last run
+			os.Remove(s.ServiceAddress)
+		}
+		conn, err := net.ListenPacket(s.Protocol, s.ServiceAddress)
+		if err != nil {
+			return err
+		}
+		if s.ReadBufferSize > 0 {
+			if rb, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+				if err := rb.SetReadBuffer(s.ReadBufferSize); err != nil {
+					log.Println("W! statsd: failed to set read buffer:", err)
+				}
+			}
+		}
+		s.packetConn = conn
+		s.wg.Add(1)
+		go s.servePackets(conn)
+	case "tcp", "tcp4", "tcp6":
+		listener, err := net.Listen(s.Protocol, s.ServiceAddress)
+		if err != nil {
+			return err
+		}
+		s.listener = listener
+		s.wg.Add(1)
+		go s.serveTCP(listener)
+	default:
+		return fmt.Errorf("unsupported protocol: %s", s.Protocol)
+	}
+	log.Println("I! statsd listening on:", s.Protocol, s.ServiceAddress)
+	return nil
+}
+
+func (s *Statsd) servePackets(conn net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, udpPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("E! statsd: failed to read:", err)
+			}
+			return
+		}
+		s.handle(strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+func (s *Statsd) serveTCP(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("E! statsd: failed to accept:", err)
+			}
+			return
+		}
+
+		s.connsLock.Lock()
+		if len(s.conns) >= s.MaxTCPConnections {
+			s.connsLock.Unlock()
+			log.Println("W! statsd: max_tcp_connections reached, refused", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.connsLock.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Statsd) serveConn(conn net.Conn) {
+	defer func() {
+		s.connsLock.Lock()
+		delete(s.conns, conn)
+		s.connsLock.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), udpPacketSize)
+	for scanner.Scan() {
+		s.handle(scanner.Text())
+	}
+}
+
+// handle aggregates the metrics of lines at once, lines failed to parse are dropped
+func (s *Statsd) handle(lines ...string) {
+	var ms []metric
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parsed, err := parseLine(line)
+		if err != nil {
+			if config.Config.DebugMode {
+				log.Println("D! statsd:", err)
+			}
+			continue
+		}
+		ms = append(ms, parsed...)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, m := range ms {
+		s.add(m)
+	}
+}
+
+// add aggregates m, the lock is held by the caller
+func (s *Statsd) add(m metric) {
+	name, labels := applyTemplates(s.templates, m.name)
+	for k, v := range m.labels {
+		if labels == nil {
+			labels = make(map[string]string, len(m.labels))
+		}
+		labels[k] = v
+	}
+	sr := series{name: name, labels: labels}
+	key := seriesKey(name, labels)
+
+	switch m.typ {
+	case "c":
+		c, has := s.counters[key]
+		if !has {
+			c = &counter{series: sr}
+			s.counters[key] = c
+		}
+		c.value += m.value / m.rate
+	case "g":
+		g, has := s.gauges[key]
+		if !has {
+			g = &gauge{series: sr}
+			s.gauges[key] = g
+		}
+		if m.delta {
+			g.value += m.value
+		} else {
+			g.value = m.value
+		}
+	case "s":
+		st, has := s.sets[key]
+		if !has {
+			st = &set{series: sr, members: make(map[string]struct{})}
+			s.sets[key] = st
+		}
+		st.members[m.member] = struct{}{}
+	case "ms":
+		t, has := s.timings[key]
+		if !has {
+			t = &timing{series: sr, lower: m.value, upper: m.value}
+			s.timings[key] = t
+		}
+		t.add(m.value, m.rate, s.PercentileLimit)
+	}
+}
+
+func (t *timing) add(value, rate float64, limit int) {
+	t.count += 1 / rate
+	t.sum += value / rate
+	t.lower = math.Min(t.lower, value)
+	t.upper = math.Max(t.upper, value)
+
+	t.seen++
+	delta := value - t.mean
+	t.mean += delta / float64(t.seen)
+	t.m2 += delta * (value - t.mean)
+
+	// reservoir sampling beyond limit
+	if len(t.values) < limit {
+		t.values = append(t.values, value)
+	} else if i := rand.Intn(t.seen); i < limit {
+		t.values[i] = value
+	}
+}
+
+// percentile returns the nearest rank percentile p of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range keys {
+		sb.WriteByte(0xff)
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+	}
+	return sb.String()
+}
+
+// Gather flushes the metrics aggregated since the last gather
+func (s *Statsd) Gather(slist *types.SampleList) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counterType := types.Counter
+	if s.DeleteCounters {
+		counterType = types.Gauge
+	}
+	for _, c := range s.counters {
+		slist.PushFront(types.NewSample("", c.name, c.value, c.labels).SetType(counterType))
+	}
+	for _, g := range s.gauges {
+		slist.PushFront(types.NewSample("", g.name, g.value, g.labels).SetType(types.Gauge))
+	}
+	for _, st := range s.sets {
+		slist.PushFront(types.NewSample("", st.name, len(st.members), st.labels).SetType(types.Gauge))
+	}
+	for _, t := range s.timings {
+		stddev := 0.0
+		if t.seen > 1 {
+			stddev = math.Sqrt(t.m2 / float64(t.seen))
+		}
+		slist.PushSamples(t.name, map[string]interface{}{
+			"count":  t.count,
+			"sum":    t.sum,
+			"mean":   t.sum / t.count,
+			"lower":  t.lower,
+			"upper":  t.upper,
+			"stddev": stddev,
+		}, t.labels)
+
+		sort.Float64s(t.values)
+		for _, p := range s.Percentiles {
+			slist.PushFront(types.NewSample("", t.name, percentile(t.values, p), t.labels,
+				map[string]string{"quantile": fmt.Sprint(p / 100)}).SetType(types.Summary))
+		}
+	}
+
+	if s.DeleteCounters {
+		s.counters = make(map[string]*counter)
+	}
+	if s.DeleteGauges {
+		s.gauges = make(map[string]*gauge)
+	}
+	s.sets = make(map[string]*set)
+	s.timings = make(map[string]*timing)
+}
+
+// Drop closes the listener and the connections
+func (s *Statsd) Drop() {
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.connsLock.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsLock.Unlock()
+	s.wg.Wait()
+
+	if s.Protocol == "unixgram" {
+		os.Remove(s.ServiceAddress)
+	}
+}
@@ -0,0 +1,106 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestParseLine(t *testing.T) {
+	ms, err := parseLine("api.latency:12:30|d|@0.5|#env:prod,canary")
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	require.Equal(t, metric{name: "api.latency", typ: "ms", value: 30, rate: 0.5,
+		labels: map[string]string{"env": "prod", "canary": "true"}}, ms[1])
+
+	ms, err = parseLine("queue:-3|g")
+	require.NoError(t, err)
+	require.True(t, ms[0].delta)
+
+	ms, err = parseLine("_e{5,4}:title|text")
+	require.NoError(t, err)
+	require.Nil(t, ms)
+
+	for _, line := range []string{"queue", "queue:1", "queue:x|c", "queue:1|x", "queue:1|c|@2"} {
+		_, err = parseLine(line)
+		require.Error(t, err, line)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	var templates []*template
+	for _, s := range []string{"cpu.* measurement.measurement.region", "*.app.* env..service.measurement*"} {
+		tmpl, err := parseTemplate(s)
+		require.NoError(t, err)
+		templates = append(templates, tmpl)
+	}
+
+	name, labels := applyTemplates(templates, "cpu.load.us-west")
+	require.Equal(t, "cpu_load", name)
+	require.Equal(t, map[string]string{"region": "us-west"}, labels)
+
+	name, labels = applyTemplates(templates, "prod.app.checkout.http.requests")
+	require.Equal(t, "http_requests", name)
+	require.Equal(t, map[string]string{"env": "prod", "service": "checkout"}, labels)
+
+	name, labels = applyTemplates(templates, "mem.free")
+	require.Equal(t, "mem.free", name)
+	require.Nil(t, labels)
+}
+
+func TestStatsd(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	require.ErrorIs(t, (&Statsd{}).Init(), types.ErrInstancesEmpty)
+
+	s := &Statsd{ServiceAddress: "127.0.0.1:0", Percentiles: []float64{50, 100}}
+	require.NoError(t, s.Init())
+	require.NoError(t, s.Start(nil))
+	defer s.Drop()
+
+	conn, err := net.Dial("udp", s.packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hits:1|c|@0.5\nhits:2|c\nqueue:10|g\nqueue:+5|g\nusers:a|s\nusers:b|s\nusers:a|s\nlatency:10:20:30|ms\n"))
+	require.NoError(t, err)
+
+	gather := func() map[string]*types.Sample {
+		slist := types.NewSampleList()
+		s.Gather(slist)
+		ret := make(map[string]*types.Sample)
+		for _, sample := range slist.PopBackAll() {
+			key := sample.Metric
+			if q, ok := sample.Labels["quantile"]; ok {
+				key += "_" + q
+			}
+			ret[key] = sample
+		}
+		return ret
+	}
+
+	var samples map[string]*types.Sample
+	require.Eventually(t, func() bool {
+		samples = gather()
+		return len(samples) > 0
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 4.0, samples["hits"].Value)
+	require.Equal(t, 15.0, samples["queue"].Value)
+	require.Equal(t, 2, samples["users"].Value)
+	require.Equal(t, 3.0, samples["latency_count"].Value)
+	require.Equal(t, 20.0, samples["latency_mean"].Value)
+	require.Equal(t, 20.0, samples["latency_0.5"].Value)
+	require.Equal(t, 30.0, samples["latency_1"].Value)
+
+	// counters and gauges are kept across flushes, sets and timings are not
+	samples = gather()
+	require.Equal(t, 4.0, samples["hits"].Value)
+	require.Contains(t, samples, "queue")
+	require.NotContains(t, samples, "users")
+	require.NotContains(t, samples, "latency_count")
+}
@@ -211,6 +211,9 @@ func (b *Builder) toDictionary(c *logsconfig.LogsConfig) map[string]interface{}
 
 // getMetricsStatus exposes some aggregated metrics of the log agent on the agent status
 func (b *Builder) getMetricsStatus() map[string]int64 {
+	if b.logsExpVars == nil {
+		return nil
+	}
 	var metrics = make(map[string]int64, 2)
 	metrics["LogsProcessed"] = b.logsExpVars.Get("LogsProcessed").(*expvar.Int).Value()
 	metrics["LogsSent"] = b.logsExpVars.Get("LogsSent").(*expvar.Int).Value()
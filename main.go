@@ -20,10 +20,12 @@ import (
 	"flashcat.cloud/categraf/agent"
 	agentInstall "flashcat.cloud/categraf/agent/install"
 	agentUpdate "flashcat.cloud/categraf/agent/update"
+	"flashcat.cloud/categraf/aggregators"
 	"flashcat.cloud/categraf/api"
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/heartbeat"
 	"flashcat.cloud/categraf/pkg/osx"
+	"flashcat.cloud/categraf/processors"
 	"flashcat.cloud/categraf/writer"
 )
 
@@ -44,6 +46,9 @@ var (
 	update       = flag.Bool("update", false, "Update categraf binary")
 	updateFile   = flag.String("update_url", "", "new version for categraf to download")
 	userMode     = flag.Bool("user", false, "Install categraf service with user mode")
+	checkConfig  = flag.Bool("check-config", false, "Check config.toml and the configs of inputs, exit non-zero on problems")
+	once         = flag.Bool("once", false, "Gather every input once, print the metrics and exit, exit non-zero on errors")
+	format       = flag.String("format", "json", "Output format of --once: json, prometheus or influx")
 )
 
 func init() {
@@ -97,10 +102,19 @@ func main() {
 		log.Fatalln("F! failed to init config:", err)
 	}
 
+	if *checkConfig {
+		os.Exit(runCheckConfig())
+	}
+	if *once {
+		os.Exit(runOnce())
+	}
+
 	doOSsvc()
 	printEnv()
 
 	initWriters()
+	initProcessors()
+	initAggregators()
 
 	go api.Start()
 	go heartbeat.Work()
@@ -114,12 +128,59 @@ func main() {
 	runAgent(ag)
 }
 
+// runCheckConfig prints the problems of configs, it returns the exit code
+func runCheckConfig() int {
+	problems := agent.CheckConfig()
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found in %s\n", len(problems), *configDir)
+		return 1
+	}
+	fmt.Println("configs are ok:", *configDir)
+	return 0
+}
+
+// runOnce gathers every input once and prints the metrics, it returns the exit code
+func runOnce() int {
+	if !writer.ValidFormat(*format) {
+		fmt.Fprintln(os.Stderr, "unknown format:", *format)
+		return 2
+	}
+	initProcessors()
+
+	results := agent.Once()
+	if err := agent.PrintOnce(os.Stdout, os.Stderr, *format, results); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to print metrics:", err)
+		return 1
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
 func initWriters() {
 	if err := writer.InitWriters(); err != nil {
 		log.Fatalln("F! failed to init writer:", err)
 	}
 }
 
+func initProcessors() {
+	if err := processors.Init(); err != nil {
+		log.Fatalln("F! failed to init processors:", err)
+	}
+}
+
+func initAggregators() {
+	if err := aggregators.Init(); err != nil {
+		log.Fatalln("F! failed to init aggregators:", err)
+	}
+}
+
 func handleSignal(ag *agent.Agent) {
 
 	sc := make(chan os.Signal, 1)
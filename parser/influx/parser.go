@@ -15,6 +15,8 @@ import (
 type Parser struct {
 	defaultTime TimeFunc
 	precision   lineprotocol.Precision
+	// samples carry the timestamps of lines
+	keepTime bool
 }
 
 type TimeFunc func() time.Time
@@ -27,14 +29,47 @@ func NewParser() *Parser {
 	}
 }
 
+// NewParserWithTime returns a Parser stamping samples with the timestamps of lines in precision,
+// lines without timestamp are stamped with now
+func NewParserWithTime(precision lineprotocol.Precision) *Parser {
+	return &Parser{
+		defaultTime: time.Now,
+		precision:   precision,
+		keepTime:    true,
+	}
+}
+
 func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
+	p.parse(input, slist, func(err error) {
+		log.Println("E! failed to parse influx line:", string(input), err)
+	})
+	return nil
+}
+
+// ParseLines is Parse without logging, it returns the number of lines failed to parse and
+// the first error
+func (p *Parser) ParseLines(input []byte, slist *types.SampleList) (int, error) {
+	var (
+		fails int
+		first error
+	)
+	p.parse(input, slist, func(err error) {
+		if fails == 0 {
+			first = err
+		}
+		fails++
+	})
+	return fails, first
+}
+
+func (p *Parser) parse(input []byte, slist *types.SampleList, onError func(error)) {
 	metrics := make([]types.Metric, 0)
 	decoder := lineprotocol.NewDecoderWithBytes(input)
 
 	for decoder.Next() {
 		m, err := nextMetric(decoder, p.precision, p.defaultTime)
 		if err != nil {
-			log.Println("E! failed to parse influx line:", string(input), err)
+			onError(err)
 			continue
 		}
 		metrics = append(metrics, m)
@@ -45,11 +80,13 @@ func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
 		tags := m.Tags()
 		fields := m.Fields()
 		for k, v := range fields {
-			slist.PushSample(name, k, v, tags)
+			sample := types.NewSample(name, k, v, tags)
+			if p.keepTime {
+				sample.SetTime(m.Time())
+			}
+			slist.PushFront(sample)
 		}
 	}
-
-	return nil
 }
 
 func nextMetric(decoder *lineprotocol.Decoder, precision lineprotocol.Precision, defaultTime TimeFunc) (types.Metric, error) {
@@ -0,0 +1,42 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestParseLinesWithTime(t *testing.T) {
+	input := []byte("cpu,host=a usage=1.5,idle=98i 1700000000\n" +
+		"cpu,host=b usage=2\n" +
+		"broken line\n")
+
+	slist := types.NewSampleList()
+	fails, err := NewParserWithTime(lineprotocol.Second).ParseLines(input, slist)
+	require.Equal(t, 1, fails)
+	require.Error(t, err)
+
+	samples := slist.PopBackAll()
+	require.Len(t, samples, 3)
+	for _, s := range samples {
+		switch s.Labels["host"] {
+		case "a":
+			require.Equal(t, time.Unix(1700000000, 0), s.Timestamp)
+			require.Contains(t, []string{"cpu_usage", "cpu_idle"}, s.Metric)
+		case "b":
+			require.Equal(t, "cpu_usage", s.Metric)
+			require.WithinDuration(t, time.Now(), s.Timestamp, time.Minute)
+		default:
+			t.Fatalf("unexpected sample: %v", s)
+		}
+	}
+
+	// samples of exec are stamped when processed
+	slist = types.NewSampleList()
+	require.NoError(t, NewParser().Parse(input[:40], slist))
+	require.True(t, slist.PopBackAll()[0].Timestamp.IsZero())
+}
@@ -0,0 +1,382 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	scopeNameLabel = "otel_scope_name"
+	// a delta series not pushed within totalExpire starts from zero again
+	totalExpire = time.Hour
+	purgePeriod = 10 * time.Minute
+)
+
+// Parser converts OTLP metrics into samples. Resource and scope attributes become labels,
+// overridden by the attributes of data points. Delta sums and histograms are accumulated into
+// cumulative ones by series when pushed. Histograms are exploded into _bucket, _sum and _count,
+// exponential ones are native histograms with _sum and _count. The totals are those of one
+// client, a parser is kept per client.
+type Parser struct {
+	sync.Mutex
+	totals    map[string]*total
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+type total struct {
+	value float64
+	seen  time.Time
+}
+
+func NewParser() *Parser {
+	return &Parser{
+		totals:    make(map[string]*total),
+		lastPurge: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Batch is the samples of an export request
+type Batch struct {
+	Samples []*types.Sample
+	// samples of delta series, they carry the deltas until pushed
+	deltas []delta
+}
+
+type delta struct {
+	sample *types.Sample
+	// series key before any label is added
+	key   string
+	value float64
+}
+
+// Parse returns the samples of rms, the totals of delta series are not touched until Push
+func (p *Parser) Parse(rms []*metricspb.ResourceMetrics) *Batch {
+	b := &Batch{}
+	var samples []*types.Sample
+	for _, rm := range rms {
+		resource := attributes(rm.GetResource().GetAttributes(), nil)
+		for _, sm := range rm.GetScopeMetrics() {
+			labels := resource
+			if name := sm.GetScope().GetName(); name != "" {
+				labels = attributes(nil, resource)
+				labels[scopeNameLabel] = name
+			}
+			for _, m := range sm.GetMetrics() {
+				samples = b.appendMetric(samples, m, labels)
+			}
+		}
+	}
+	b.Samples = samples
+	return b
+}
+
+// Push replaces the deltas of b with the totals of their series and calls push with the samples.
+// The totals go forward only if push succeeds, so that a retry of a rejected request is not
+// counted twice. Pushes of a parser are serialized to keep the totals in order.
+func (p *Parser) Push(b *Batch, push func([]*types.Sample) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	// a series may have several data points in a request
+	pending := make(map[string]float64, len(b.deltas))
+	for _, d := range b.deltas {
+		value, has := pending[d.key]
+		if !has {
+			if t, ok := p.totals[d.key]; ok {
+				value = t.value
+			}
+		}
+		value += d.value
+		pending[d.key] = value
+		d.sample.Value = value
+	}
+
+	if err := push(b.Samples); err != nil {
+		return err
+	}
+
+	now := p.now()
+	for key, value := range pending {
+		p.totals[key] = &total{value: value, seen: now}
+	}
+	p.purge(now)
+	return nil
+}
+
+// point is the emission of the samples of a data point
+type point struct {
+	b      *Batch
+	m      *metricspb.Metric
+	labels map[string]string
+	ts     time.Time
+	delta  bool
+}
+
+func (pt *point) sample(suffix string, value float64, typ types.ValueType, extra map[string]string) *types.Sample {
+	name := pt.m.GetName()
+	if suffix != "" {
+		name += "_" + suffix
+	}
+	s := types.NewSample("", name, value, pt.labels, extra).SetTime(pt.ts).SetType(typ)
+	s.Help = pt.m.GetDescription()
+	s.Unit = pt.m.GetUnit()
+	if pt.delta {
+		pt.b.deltas = append(pt.b.deltas, delta{sample: s, key: s.SeriesKey(), value: value})
+	}
+	return s
+}
+
+func newPoint(b *Batch, m *metricspb.Metric, labels map[string]string, attrs []*commonpb.KeyValue, ts uint64, temporality metricspb.AggregationTemporality) *point {
+	return &point{
+		b:      b,
+		m:      m,
+		labels: attributes(attrs, labels),
+		ts:     time.Unix(0, int64(ts)),
+		delta:  temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+	}
+}
+
+func noValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func (b *Batch) appendMetric(samples []*types.Sample, m *metricspb.Metric, labels map[string]string) []*types.Sample {
+	switch {
+	case m.GetGauge() != nil:
+		for _, dp := range m.GetGauge().GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			pt := newPoint(b, m, labels, dp.GetAttributes(), dp.GetTimeUnixNano(), 0)
+			samples = append(samples, pt.sample("", numberValue(dp), types.Gauge, nil))
+		}
+	case m.GetSum() != nil:
+		sum := m.GetSum()
+		typ := types.Gauge
+		if sum.GetIsMonotonic() {
+			typ = types.Counter
+		}
+		for _, dp := range sum.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			pt := newPoint(b, m, labels, dp.GetAttributes(), dp.GetTimeUnixNano(), sum.GetAggregationTemporality())
+			samples = append(samples, pt.sample("", numberValue(dp), typ, nil))
+		}
+	case m.GetHistogram() != nil:
+		h := m.GetHistogram()
+		for _, dp := range h.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			pt := newPoint(b, m, labels, dp.GetAttributes(), dp.GetTimeUnixNano(), h.GetAggregationTemporality())
+			bounds := dp.GetExplicitBounds()
+			counts := dp.GetBucketCounts()
+			buckets := make([]bucket, 0, len(bounds))
+			for i := 0; i < len(bounds) && i < len(counts); i++ {
+				buckets = append(buckets, bucket{upper: bounds[i], count: counts[i]})
+			}
+			samples = pt.appendHistogram(samples, buckets, dp.GetCount(), dp.Sum)
+		}
+	case m.GetExponentialHistogram() != nil:
+		h := m.GetExponentialHistogram()
+		for _, dp := range h.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			pt := newPoint(b, m, labels, dp.GetAttributes(), dp.GetTimeUnixNano(), h.GetAggregationTemporality())
+			samples = pt.appendExponentialHistogram(samples, dp)
+		}
+	case m.GetSummary() != nil:
+		for _, dp := range m.GetSummary().GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			pt := newPoint(b, m, labels, dp.GetAttributes(), dp.GetTimeUnixNano(), 0)
+			samples = append(samples,
+				pt.sample("count", float64(dp.GetCount()), types.Summary, nil),
+				pt.sample("sum", dp.GetSum(), types.Summary, nil))
+			for _, q := range dp.GetQuantileValues() {
+				samples = append(samples, pt.sample("", q.GetValue(), types.Summary, map[string]string{"quantile": fmt.Sprint(q.GetQuantile())}))
+			}
+		}
+	}
+	return samples
+}
+
+// bucket is a bucket of a histogram, count is not cumulative
+type bucket struct {
+	upper float64
+	count uint64
+}
+
+// appendHistogram appends the samples of a histogram, buckets are sorted by upper bound
+func (pt *point) appendHistogram(samples []*types.Sample, buckets []bucket, count uint64, sum *float64) []*types.Sample {
+	var cumulative uint64
+	for _, b := range buckets {
+		cumulative += b.count
+		samples = append(samples, pt.sample("bucket", float64(cumulative), types.Histogram, map[string]string{"le": fmt.Sprint(b.upper)}))
+	}
+	samples = append(samples,
+		pt.sample("bucket", float64(count), types.Histogram, map[string]string{"le": "+Inf"}),
+		pt.sample("count", float64(count), types.Histogram, nil))
+	if sum != nil {
+		samples = append(samples, pt.sample("sum", *sum, types.Histogram, nil))
+	}
+	return samples
+}
+
+// appendExponentialHistogram appends an exponential histogram as a native histogram, its buckets
+// are not exploded into _bucket series whose bounds would change with the scale. _count and _sum
+// are appended as well for the writers not sending native histograms.
+func (pt *point) appendExponentialHistogram(samples []*types.Sample, dp *metricspb.ExponentialHistogramDataPoint) []*types.Sample {
+	if h := nativeHistogram(dp, pt.delta); h != nil {
+		s := types.NewSample("", pt.m.GetName(), nil, pt.labels).SetTime(pt.ts).SetType(types.Histogram)
+		s.Help = pt.m.GetDescription()
+		s.Unit = pt.m.GetUnit()
+		s.Histogram = h
+		samples = append(samples, s)
+	}
+	samples = append(samples, pt.sample("count", float64(dp.GetCount()), types.Histogram, nil))
+	if dp.Sum != nil {
+		samples = append(samples, pt.sample("sum", dp.GetSum(), types.Histogram, nil))
+	}
+	return samples
+}
+
+const (
+	// scales of native histograms, finer ones are scaled down
+	minNativeScale = -4
+	maxNativeScale = 8
+)
+
+// nativeHistogram converts dp to a native histogram, nil if its scale is too coarse. Deltas are
+// gauge histograms, they are not accumulated.
+func nativeHistogram(dp *metricspb.ExponentialHistogramDataPoint, delta bool) *prompb.Histogram {
+	scale := dp.GetScale()
+	if scale < minNativeScale {
+		return nil
+	}
+	var scaleDown int32
+	if scale > maxNativeScale {
+		scaleDown = scale - maxNativeScale
+		scale = maxNativeScale
+	}
+
+	h := &prompb.Histogram{
+		Count:         &prompb.Histogram_CountInt{CountInt: dp.GetCount()},
+		Sum:           dp.GetSum(),
+		Schema:        scale,
+		ZeroThreshold: dp.GetZeroThreshold(),
+		ZeroCount:     &prompb.Histogram_ZeroCountInt{ZeroCountInt: dp.GetZeroCount()},
+	}
+	h.PositiveSpans, h.PositiveDeltas = nativeBuckets(dp.GetPositive(), scaleDown)
+	h.NegativeSpans, h.NegativeDeltas = nativeBuckets(dp.GetNegative(), scaleDown)
+	if delta {
+		h.ResetHint = prompb.Histogram_GAUGE
+	}
+	return h
+}
+
+// nativeBuckets converts the buckets of an exponential histogram to a span and the deltas of its
+// counts. The bucket of index i covers (base^i, base^(i+1)] in OTLP, it is i+1 of native histograms.
+func nativeBuckets(b *metricspb.ExponentialHistogramDataPoint_Buckets, scaleDown int32) ([]*prompb.BucketSpan, []int64) {
+	counts := b.GetBucketCounts()
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	start := b.GetOffset()>>scaleDown + 1
+	var merged []int64
+	for i, c := range counts {
+		pos := int((b.GetOffset()+int32(i))>>scaleDown + 1 - start)
+		for len(merged) <= pos {
+			merged = append(merged, 0)
+		}
+		merged[pos] += int64(c)
+	}
+
+	deltas := make([]int64, len(merged))
+	var prev int64
+	for i, c := range merged {
+		deltas[i] = c - prev
+		prev = c
+	}
+	return []*prompb.BucketSpan{{Offset: start, Length: uint32(len(merged))}}, deltas
+}
+
+// purge forgets the totals of series not pushed within totalExpire, the lock is held by the caller
+func (p *Parser) purge(now time.Time) {
+	if now.Sub(p.lastPurge) < purgePeriod {
+		return
+	}
+	for k, t := range p.totals {
+		if now.Sub(t.seen) > totalExpire {
+			delete(p.totals, k)
+		}
+	}
+	p.lastPurge = now
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	}
+	return 0
+}
+
+// attributes returns base with attrs added
+func attributes(attrs []*commonpb.KeyValue, base map[string]string) map[string]string {
+	ret := make(map[string]string, len(base)+len(attrs))
+	for k, v := range base {
+		ret[k] = v
+	}
+	for _, kv := range attrs {
+		if kv.GetKey() == "" {
+			continue
+		}
+		ret[kv.GetKey()] = anyValue(kv.GetValue())
+	}
+	return ret
+}
+
+func anyValue(v *commonpb.AnyValue) string {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return fmt.Sprint(x.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return fmt.Sprint(x.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return fmt.Sprint(x.DoubleValue)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(x.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]string, 0, len(x.ArrayValue.GetValues()))
+		for _, e := range x.ArrayValue.GetValues() {
+			values = append(values, anyValue(e))
+		}
+		return "[" + strings.Join(values, ",") + "]"
+	case *commonpb.AnyValue_KvlistValue:
+		values := make([]string, 0, len(x.KvlistValue.GetValues()))
+		for _, kv := range x.KvlistValue.GetValues() {
+			values = append(values, kv.GetKey()+"="+anyValue(kv.GetValue()))
+		}
+		return "{" + strings.Join(values, ",") + "}"
+	}
+	return ""
+}
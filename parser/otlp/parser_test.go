@@ -0,0 +1,165 @@
+package otlp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func resourceMetrics(metrics ...*metricspb.Metric) []*metricspb.ResourceMetrics {
+	return []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "api")}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{
+			Scope:   &commonpb.InstrumentationScope{Name: "meter"},
+			Metrics: metrics,
+		}},
+	}}
+}
+
+func byName(samples []*types.Sample) map[string][]*types.Sample {
+	ret := make(map[string][]*types.Sample)
+	for _, s := range samples {
+		ret[s.Metric] = append(ret[s.Metric], s)
+	}
+	return ret
+}
+
+func TestParseGaugeAndSum(t *testing.T) {
+	ts := uint64(time.Unix(1700000000, 0).UnixNano())
+	p := NewParser()
+	delta := &metricspb.Metric{
+		Name: "requests",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            true,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Attributes:   []*commonpb.KeyValue{stringAttr("code", "200")},
+				TimeUnixNano: ts,
+				Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 3},
+			}},
+		}},
+	}
+	gauge := &metricspb.Metric{
+		Name: "temperature",
+		Unit: "Cel",
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+			{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5}},
+			{TimeUnixNano: ts, Flags: uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)},
+		}}},
+	}
+
+	push := func(b *Batch) map[string][]*types.Sample {
+		require.NoError(t, p.Push(b, func([]*types.Sample) error { return nil }))
+		return byName(b.Samples)
+	}
+
+	samples := push(p.Parse(resourceMetrics(delta, gauge)))
+	require.Len(t, samples["temperature"], 1)
+	s := samples["temperature"][0]
+	require.Equal(t, 21.5, s.Value)
+	require.Equal(t, "Cel", s.Unit)
+	require.Equal(t, time.Unix(1700000000, 0), s.Timestamp)
+	require.Equal(t, map[string]string{"service.name": "api", scopeNameLabel: "meter"}, s.Labels)
+
+	s = samples["requests"][0]
+	require.Equal(t, 3.0, s.Value)
+	require.Equal(t, types.Counter, s.Type)
+	require.Equal(t, "200", s.Labels["code"])
+
+	// delta sums are accumulated
+	samples = push(p.Parse(resourceMetrics(delta)))
+	require.Equal(t, 6.0, samples["requests"][0].Value)
+
+	// a rejected request does not count, its retry does once
+	b := p.Parse(resourceMetrics(delta))
+	require.Error(t, p.Push(b, func([]*types.Sample) error { return errors.New("queue full") }))
+	samples = push(p.Parse(resourceMetrics(delta)))
+	require.Equal(t, 9.0, samples["requests"][0].Value)
+
+	// totals are those of the parser, i.e. of one client
+	other := NewParser()
+	b = other.Parse(resourceMetrics(delta))
+	require.NoError(t, other.Push(b, func([]*types.Sample) error { return nil }))
+	require.Equal(t, 3.0, b.Samples[0].Value)
+}
+
+func TestParseHistograms(t *testing.T) {
+	sum := 12.5
+	h := &metricspb.Metric{
+		Name: "latency",
+		Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.HistogramDataPoint{{
+				Count:          6,
+				Sum:            &sum,
+				ExplicitBounds: []float64{1, 5},
+				BucketCounts:   []uint64{2, 3, 1},
+			}},
+		}},
+	}
+	eh := &metricspb.Metric{
+		Name: "size",
+		Data: &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.ExponentialHistogramDataPoint{{
+				Count:     4,
+				Scale:     0,
+				ZeroCount: 1,
+				Positive:  &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: 1, BucketCounts: []uint64{1, 2}},
+			}},
+		}},
+	}
+
+	buckets := func(samples []*types.Sample) map[string]float64 {
+		ret := make(map[string]float64)
+		for _, s := range samples {
+			ret[s.Labels["le"]] = s.Value.(float64)
+		}
+		return ret
+	}
+
+	samples := byName(NewParser().Parse(resourceMetrics(h, eh)).Samples)
+	require.Equal(t, map[string]float64{"1": 2, "5": 5, "+Inf": 6}, buckets(samples["latency_bucket"]))
+	require.Equal(t, 6.0, samples["latency_count"][0].Value)
+	require.Equal(t, 12.5, samples["latency_sum"][0].Value)
+
+	// exponential histograms are native ones, OTLP bucket i covering (2^i, 2^(i+1)] is bucket i+1
+	require.Len(t, samples["size_bucket"], 0)
+	require.Len(t, samples["size"], 1)
+	nh := samples["size"][0].Histogram
+	require.EqualValues(t, 0, nh.Schema)
+	require.Equal(t, []*prompb.BucketSpan{{Offset: 2, Length: 2}}, nh.PositiveSpans)
+	require.Equal(t, []int64{1, 1}, nh.PositiveDeltas)
+	require.EqualValues(t, 4, nh.GetCountInt())
+	require.EqualValues(t, 1, nh.GetZeroCountInt())
+	require.Equal(t, prompb.Histogram_UNKNOWN, nh.ResetHint)
+	require.Equal(t, 4.0, samples["size_count"][0].Value)
+	require.Len(t, samples["size_sum"], 0)
+}
+
+func TestNativeHistogramScaleDown(t *testing.T) {
+	h := nativeHistogram(&metricspb.ExponentialHistogramDataPoint{
+		Count:    5,
+		Scale:    10,
+		Positive: &metricspb.ExponentialHistogramDataPoint_Buckets{BucketCounts: []uint64{1, 1, 1, 1, 1}},
+	}, true)
+	// 4 buckets of scale 10 make one of scale 8
+	require.EqualValues(t, 8, h.Schema)
+	require.Equal(t, []*prompb.BucketSpan{{Offset: 1, Length: 2}}, h.PositiveSpans)
+	require.Equal(t, []int64{4, -3}, h.PositiveDeltas)
+	require.Equal(t, prompb.Histogram_GAUGE, h.ResetHint)
+
+	require.Nil(t, nativeHistogram(&metricspb.ExponentialHistogramDataPoint{Scale: -5}, false))
+}
@@ -22,6 +22,8 @@ type ConfigWithFormat struct {
 	Config   string       `json:"config"`
 	Format   ConfigFormat `json:"format"`
 	checkSum string       `json:"-"`
+	// where the config is read from, like a file path, for error messages
+	Source string `json:"-"`
 }
 
 func (cwf *ConfigWithFormat) CheckSum() string {
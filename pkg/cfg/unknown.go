@@ -0,0 +1,105 @@
+package cfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/toolkits/pkg/file"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// UnknownKeys decodes c into configPtr strictly, it returns the keys of c that match no
+// field of configPtr. Decoding errors, like type mismatches, are returned as error.
+func UnknownKeys(c ConfigWithFormat, configPtr interface{}) ([]string, error) {
+	switch c.Format {
+	case YamlFormat:
+		err := yaml.UnmarshalStrict([]byte(c.Config), configPtr)
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			return nil, err
+		}
+		// unknown fields and type mismatches are both type errors
+		var unknown, other []string
+		for _, e := range te.Errors {
+			if strings.Contains(e, " not found in type ") {
+				unknown = append(unknown, e)
+			} else {
+				other = append(other, e)
+			}
+		}
+		if len(other) > 0 {
+			return unknown, errors.New(strings.Join(other, "; "))
+		}
+		return unknown, nil
+	case JsonFormat:
+		dec := json.NewDecoder(strings.NewReader(c.Config))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(configPtr)
+		if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+			// the decoder stops at the first unknown field
+			return []string{strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)}, nil
+		}
+		return nil, err
+	default:
+		md, err := toml.Decode(c.Config, configPtr)
+		if err != nil {
+			return nil, err
+		}
+		var unknown []string
+		for _, k := range md.Undecoded() {
+			unknown = append(unknown, k.String())
+		}
+		return unknown, nil
+	}
+}
+
+// UnknownKeysOfDir is UnknownKeys of the config files under configDir, the same files read by
+// LoadConfigByDir. The unknown keys are by file.
+func UnknownKeysOfDir(configDir string, newConfig func() interface{}) (map[string][]string, error) {
+	files, err := file.FilesUnder(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// toml files are loaded as one document
+	var tBuf bytes.Buffer
+	var tFiles []string
+	ret := make(map[string][]string)
+	for _, fpath := range files {
+		format := GuessFormat(fpath)
+		if !(strings.HasSuffix(fpath, ".toml") || format != TomlFormat) {
+			continue
+		}
+		data, err := file.ReadBytes(path.Join(configDir, fpath))
+		if err != nil {
+			return nil, err
+		}
+		if format == TomlFormat {
+			tBuf.Write(data)
+			tBuf.WriteString("\n")
+			tFiles = append(tFiles, fpath)
+			continue
+		}
+		unknown, err := UnknownKeys(ConfigWithFormat{Config: string(data), Format: format}, newConfig())
+		if err != nil {
+			return nil, err
+		}
+		if len(unknown) > 0 {
+			ret[fpath] = unknown
+		}
+	}
+	if tBuf.Len() > 0 {
+		unknown, err := UnknownKeys(ConfigWithFormat{Config: tBuf.String(), Format: TomlFormat}, newConfig())
+		if err != nil {
+			return nil, err
+		}
+		if len(unknown) > 0 {
+			ret[strings.Join(tFiles, ",")] = unknown
+		}
+	}
+	return ret, nil
+}
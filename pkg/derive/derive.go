@@ -0,0 +1,80 @@
+package derive
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultTTL = 10 * time.Minute
+
+type point struct {
+	value float64
+	ts    time.Time
+	seen  time.Time
+}
+
+// Tracker remembers the previous value of counters to turn them into deltas or rates
+type Tracker struct {
+	sync.Mutex
+	last      map[string]point
+	ttl       time.Duration
+	lastPurge time.Time
+}
+
+// NewTracker creates a Tracker, series not updated within ttl are forgotten
+func NewTracker(ttl time.Duration) *Tracker {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Tracker{
+		last:      make(map[string]point),
+		ttl:       ttl,
+		lastPurge: time.Now(),
+	}
+}
+
+// Delta returns the increase of the counter key since its previous value. A value
+// lower than the previous one is a counter reset, the increase is the value itself then.
+// ok is false for the first value of a series, or a value not newer than the previous one.
+func (t *Tracker) Delta(key string, value float64, ts time.Time) (delta float64, elapsed time.Duration, ok bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	prev, has := t.last[key]
+	if has && !ts.After(prev.ts) {
+		return 0, 0, false
+	}
+	t.last[key] = point{value: value, ts: ts, seen: now}
+	t.purge(now)
+	if !has {
+		return 0, 0, false
+	}
+
+	delta = value - prev.value
+	if value < prev.value {
+		delta = value
+	}
+	return delta, ts.Sub(prev.ts), true
+}
+
+// Rate returns the per-second increase of the counter key since its previous value
+func (t *Tracker) Rate(key string, value float64, ts time.Time) (float64, bool) {
+	delta, elapsed, ok := t.Delta(key, value, ts)
+	if !ok || elapsed <= 0 {
+		return 0, false
+	}
+	return delta / elapsed.Seconds(), true
+}
+
+func (t *Tracker) purge(now time.Time) {
+	if now.Sub(t.lastPurge) < t.ttl {
+		return
+	}
+	for k, p := range t.last {
+		if now.Sub(p.seen) > t.ttl {
+			delete(t.last, k)
+		}
+	}
+	t.lastPurge = now
+}
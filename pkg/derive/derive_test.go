@@ -0,0 +1,35 @@
+package derive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRate(t *testing.T) {
+	tr := NewTracker(0)
+	now := time.Now()
+
+	_, ok := tr.Rate("a", 100, now)
+	require.False(t, ok)
+
+	r, ok := tr.Rate("a", 160, now.Add(30*time.Second))
+	require.True(t, ok)
+	require.Equal(t, 2.0, r)
+
+	// not newer than the previous value
+	_, ok = tr.Rate("a", 200, now.Add(30*time.Second))
+	require.False(t, ok)
+}
+
+func TestDeltaCounterReset(t *testing.T) {
+	tr := NewTracker(0)
+	now := time.Now()
+
+	tr.Delta("a", 100, now)
+	d, elapsed, ok := tr.Delta("a", 20, now.Add(10*time.Second))
+	require.True(t, ok)
+	require.Equal(t, 20.0, d)
+	require.Equal(t, 10*time.Second, elapsed)
+}
@@ -0,0 +1,454 @@
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+	headerSize    = 8
+
+	defaultSegmentBytes = 64 * 1024 * 1024
+)
+
+var ErrClosed = errors.New("disk queue closed")
+
+// Options controls where and how much a Queue may store
+type Options struct {
+	// Dir is the directory holding segment files and the read cursor
+	Dir string
+	// MaxBytes caps the total size of all segments, the oldest segments are dropped first
+	MaxBytes int64
+	// MaxAge drops segments whose last write is older than it
+	MaxAge time.Duration
+	// SegmentBytes is the size after which a new segment file is started
+	SegmentBytes int64
+}
+
+// Stats is a point-in-time view of the queue
+type Stats struct {
+	Count     int64
+	Bytes     int64
+	Appended  uint64
+	Committed uint64
+	Dropped   uint64
+}
+
+type segment struct {
+	id    uint64
+	path  string
+	size  int64
+	count int64
+	mtime time.Time
+}
+
+// Queue is a FIFO of byte records persisted as append-only segment files.
+// Records are read with Peek and removed with Commit, the read position
+// survives restarts so unacknowledged records are delivered again.
+type Queue struct {
+	sync.Mutex
+
+	opts     Options
+	segments []*segment
+	lastID   uint64
+	writer   *os.File
+	reader   *os.File
+
+	// read cursor: offset inside segments[0] and records consumed there
+	readOff      int64
+	headConsumed int64
+	peekSize     int64
+
+	count int64
+	bytes int64
+
+	appended  uint64
+	committed uint64
+	dropped   uint64
+
+	closed bool
+}
+
+// Open loads the segments under opts.Dir and starts a fresh segment for writing
+func Open(opts Options) (*Queue, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("disk queue: dir is empty")
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("disk queue: failed to create %s: %v", opts.Dir, err)
+	}
+
+	q := &Queue{opts: opts}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := q.rotate(); err != nil {
+		return nil, err
+	}
+	q.expire()
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("disk queue: failed to read %s: %v", q.opts.Dir, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		seg := &segment{
+			id:    id,
+			path:  filepath.Join(q.opts.Dir, name),
+			mtime: info.ModTime(),
+		}
+		seg.count, seg.size = scanSegment(seg.path, -1)
+		if seg.size == 0 {
+			os.Remove(seg.path)
+			continue
+		}
+		q.segments = append(q.segments, seg)
+	}
+	sort.Slice(q.segments, func(i, j int) bool {
+		return q.segments[i].id < q.segments[j].id
+	})
+
+	segID, off := q.readCursor()
+	q.lastID = segID
+	if n := len(q.segments); n > 0 && q.segments[n-1].id > q.lastID {
+		q.lastID = q.segments[n-1].id
+	}
+	for len(q.segments) > 0 && q.segments[0].id < segID {
+		os.Remove(q.segments[0].path)
+		q.segments = q.segments[1:]
+	}
+	if len(q.segments) > 0 && q.segments[0].id == segID && off > 0 {
+		q.headConsumed, q.readOff = scanSegment(q.segments[0].path, off)
+	}
+
+	for _, seg := range q.segments {
+		q.count += seg.count
+		q.bytes += seg.size
+	}
+	q.count -= q.headConsumed
+	q.bytes -= q.readOff
+	return nil
+}
+
+// scanSegment counts the valid records of a segment up to limit bytes (-1 for all),
+// it returns the record count and the offset right after the last valid record
+func scanSegment(path string, limit int64) (int64, int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	var (
+		count int64
+		off   int64
+		hdr   [headerSize]byte
+	)
+	for limit < 0 || off < limit {
+		if _, err := f.ReadAt(hdr[:], off); err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		data := make([]byte, size)
+		if _, err := f.ReadAt(data, off+headerSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(hdr[4:]) {
+			break
+		}
+		off += headerSize + size
+		count++
+	}
+	return count, off
+}
+
+func (q *Queue) readCursor() (uint64, int64) {
+	bs, err := os.ReadFile(filepath.Join(q.opts.Dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	fields := strings.Fields(string(bs))
+	if len(fields) != 2 {
+		return 0, 0
+	}
+	id, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0
+	}
+	off, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0
+	}
+	return id, off
+}
+
+func (q *Queue) writeCursor() error {
+	var (
+		id  uint64
+		off int64
+	)
+	if len(q.segments) > 0 {
+		id, off = q.segments[0].id, q.readOff
+	}
+	tmp := filepath.Join(q.opts.Dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", id, off)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.opts.Dir, cursorFile))
+}
+
+func (q *Queue) rotate() error {
+	q.lastID++
+	id := q.lastID
+	if q.writer != nil {
+		q.writer.Close()
+		q.writer = nil
+	}
+
+	path := filepath.Join(q.opts.Dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("disk queue: failed to create segment %s: %v", path, err)
+	}
+	q.writer = f
+	q.segments = append(q.segments, &segment{id: id, path: path, mtime: time.Now()})
+	return nil
+}
+
+// Append writes one record at the tail of the queue
+func (q *Queue) Append(data []byte) error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	tail := q.segments[len(q.segments)-1]
+	if tail.size >= q.opts.SegmentBytes {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		tail = q.segments[len(q.segments)-1]
+	}
+
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	copy(buf[headerSize:], data)
+	if _, err := q.writer.Write(buf); err != nil {
+		return err
+	}
+	if err := q.writer.Sync(); err != nil {
+		return err
+	}
+
+	tail.size += int64(len(buf))
+	tail.count++
+	tail.mtime = time.Now()
+	q.count++
+	q.bytes += int64(len(buf))
+	q.appended++
+
+	q.expire()
+	return nil
+}
+
+// Peek returns the oldest record without removing it, nil means the queue is empty
+func (q *Queue) Peek() ([]byte, error) {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	q.expire()
+
+	for {
+		head := q.segments[0]
+		if q.readOff >= head.size {
+			if len(q.segments) == 1 {
+				return nil, nil
+			}
+			q.dropHead(false)
+			continue
+		}
+
+		data, err := q.readAt(head, q.readOff)
+		if err != nil {
+			// the rest of this segment is unreadable, skip to the next one
+			log.Printf("W! disk queue: skip corrupted segment %s at offset %d: %v", head.path, q.readOff, err)
+			if len(q.segments) == 1 {
+				if err := q.rotate(); err != nil {
+					return nil, err
+				}
+			}
+			q.dropHead(true)
+			continue
+		}
+		q.peekSize = headerSize + int64(len(data))
+		return data, nil
+	}
+}
+
+func (q *Queue) readAt(seg *segment, off int64) ([]byte, error) {
+	if q.reader == nil || q.reader.Name() != seg.path {
+		if q.reader != nil {
+			q.reader.Close()
+		}
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		q.reader = f
+	}
+
+	var hdr [headerSize]byte
+	if _, err := q.reader.ReadAt(hdr[:], off); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(hdr[:4]))
+	if off+headerSize+size > seg.size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, size)
+	if _, err := q.reader.ReadAt(data, off+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(hdr[4:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// Commit removes the record returned by the last Peek
+func (q *Queue) Commit() error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if q.peekSize == 0 {
+		return nil
+	}
+
+	q.readOff += q.peekSize
+	q.headConsumed++
+	q.count--
+	q.bytes -= q.peekSize
+	q.peekSize = 0
+	q.committed++
+	return q.writeCursor()
+}
+
+// dropHead removes the first segment, counting its unread records as dropped if lost is true
+func (q *Queue) dropHead(lost bool) {
+	head := q.segments[0]
+	remain := head.count - q.headConsumed
+	if remain > 0 {
+		q.count -= remain
+		if lost {
+			q.dropped += uint64(remain)
+		}
+	}
+	q.bytes -= head.size - q.readOff
+	if q.reader != nil && q.reader.Name() == head.path {
+		q.reader.Close()
+		q.reader = nil
+	}
+	os.Remove(head.path)
+
+	q.segments = q.segments[1:]
+	q.readOff = 0
+	q.headConsumed = 0
+	q.peekSize = 0
+	if err := q.writeCursor(); err != nil {
+		log.Println("W! disk queue: failed to persist cursor:", err)
+	}
+}
+
+// expire drops the oldest segments exceeding MaxBytes or MaxAge, the segment being written is kept
+func (q *Queue) expire() {
+	for len(q.segments) > 1 {
+		head := q.segments[0]
+		overSize := q.opts.MaxBytes > 0 && q.bytes > q.opts.MaxBytes
+		overAge := q.opts.MaxAge > 0 && time.Since(head.mtime) > q.opts.MaxAge
+		if !overSize && !overAge {
+			break
+		}
+		q.dropHead(true)
+	}
+
+	// the tail segment only ages out when nothing was written for MaxAge
+	if len(q.segments) == 1 && q.opts.MaxAge > 0 && q.count > 0 &&
+		time.Since(q.segments[0].mtime) > q.opts.MaxAge {
+		if err := q.rotate(); err == nil {
+			q.dropHead(true)
+		}
+	}
+}
+
+// Len returns the number of records not yet committed
+func (q *Queue) Len() int64 {
+	q.Lock()
+	defer q.Unlock()
+	return q.count
+}
+
+func (q *Queue) Stats() Stats {
+	q.Lock()
+	defer q.Unlock()
+	return Stats{
+		Count:     q.count,
+		Bytes:     q.bytes,
+		Appended:  q.appended,
+		Committed: q.committed,
+		Dropped:   q.dropped,
+	}
+}
+
+func (q *Queue) Close() error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	if q.reader != nil {
+		q.reader.Close()
+	}
+	if q.writer != nil {
+		return q.writer.Close()
+	}
+	return nil
+}
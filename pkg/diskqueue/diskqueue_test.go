@@ -0,0 +1,96 @@
+package diskqueue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendPeekCommit(t *testing.T) {
+	q, err := Open(Options{Dir: t.TempDir(), SegmentBytes: 64})
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	require.EqualValues(t, 10, q.Len())
+
+	for i := 0; i < 10; i++ {
+		data, err := q.Peek()
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("record-%d", i), string(data))
+		require.NoError(t, q.Commit())
+	}
+
+	data, err := q.Peek()
+	require.NoError(t, err)
+	require.Nil(t, data)
+	require.EqualValues(t, 0, q.Len())
+	require.EqualValues(t, 0, q.Stats().Bytes)
+}
+
+func TestReopenResumesFromCursor(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(Options{Dir: dir, SegmentBytes: 64})
+	require.NoError(t, err)
+	for i := 0; i < 6; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	for i := 0; i < 4; i++ {
+		_, err := q.Peek()
+		require.NoError(t, err)
+		require.NoError(t, q.Commit())
+	}
+	// peeked but not committed, must be delivered again
+	_, err = q.Peek()
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+
+	q, err = Open(Options{Dir: dir, SegmentBytes: 64})
+	require.NoError(t, err)
+	defer q.Close()
+	require.EqualValues(t, 2, q.Len())
+
+	require.NoError(t, q.Append([]byte("record-6")))
+	for i := 4; i < 7; i++ {
+		data, err := q.Peek()
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("record-%d", i), string(data))
+		require.NoError(t, q.Commit())
+	}
+}
+
+func TestMaxBytesDropsOldest(t *testing.T) {
+	q, err := Open(Options{Dir: t.TempDir(), SegmentBytes: 16, MaxBytes: 64})
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("record-%02d", i))))
+	}
+	st := q.Stats()
+	require.LessOrEqual(t, st.Bytes, int64(64))
+	require.EqualValues(t, 20, st.Appended)
+	require.EqualValues(t, 20, int64(st.Dropped)+st.Count)
+
+	data, err := q.Peek()
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("record-%02d", st.Dropped), string(data))
+}
+
+func TestMaxAgeDropsStale(t *testing.T) {
+	q, err := Open(Options{Dir: t.TempDir(), MaxAge: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Append([]byte("old")))
+	time.Sleep(100 * time.Millisecond)
+
+	data, err := q.Peek()
+	require.NoError(t, err)
+	require.Nil(t, data)
+	require.EqualValues(t, 1, q.Stats().Dropped)
+}
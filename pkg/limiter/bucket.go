@@ -0,0 +1,51 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at rate per second, holding one second of tokens at most.
+// Unlike rateLimiter it never blocks. Requests larger than the bucket are let through as long
+// as it is not empty, the tokens are paid back by the following requests.
+type Bucket struct {
+	sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+func NewBucket(rate float64) *Bucket {
+	capacity := rate
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Bucket{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+		now:      time.Now,
+	}
+}
+
+// Allow takes n tokens, it returns false if the bucket has less than one token
+func (b *Bucket) Allow(n int) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
@@ -0,0 +1,36 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(10)
+	b.last = now
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		if !b.Allow(1) {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if b.Allow(1) {
+		t.Fatal("bucket should be empty")
+	}
+
+	// refilled by rate, a large request is paid back by the following ones
+	now = now.Add(100 * time.Millisecond)
+	if !b.Allow(25) {
+		t.Fatal("large request should be allowed once the bucket is not empty")
+	}
+	now = now.Add(time.Second)
+	if b.Allow(1) {
+		t.Fatal("tokens of the large request are not paid back yet")
+	}
+	now = now.Add(2 * time.Second)
+	if !b.Allow(1) {
+		t.Fatal("tokens should be paid back")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/matttproud/golang_protobuf_extensions/pbutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/pkg/prom"
 	"flashcat.cloud/categraf/types"
@@ -58,11 +59,11 @@ func HandleSummary(defaultPrefix string, m *dto.Metric, tags map[string]string,
 	}
 	fn := initTimeFn(tf)
 
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "count"), float64(m.GetSummary().GetSampleCount()), tags).SetTime(fn(m.GetTimestampMs())))
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "sum"), m.GetSummary().GetSampleSum(), tags).SetTime(fn(m.GetTimestampMs())))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "count"), float64(m.GetSummary().GetSampleCount()), tags).SetTime(fn(m.GetTimestampMs())).SetType(types.Summary))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "sum"), m.GetSummary().GetSampleSum(), tags).SetTime(fn(m.GetTimestampMs())).SetType(types.Summary))
 
 	for _, q := range m.GetSummary().Quantile {
-		slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName), q.GetValue(), tags, map[string]string{"quantile": fmt.Sprint(q.GetQuantile())}).SetTime(fn(m.GetTimestampMs())))
+		slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName), q.GetValue(), tags, map[string]string{"quantile": fmt.Sprint(q.GetQuantile())}).SetTime(fn(m.GetTimestampMs())).SetType(types.Summary))
 	}
 }
 
@@ -73,25 +74,72 @@ func HandleHistogram(defaultPrefix string, m *dto.Metric, tags map[string]string
 	}
 	fn := initTimeFn(tf)
 
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "count"), float64(m.GetHistogram().GetSampleCount()), tags).SetTime(fn(m.GetTimestampMs())))
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "sum"), m.GetHistogram().GetSampleSum(), tags).SetTime(fn(m.GetTimestampMs())))
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), float64(m.GetHistogram().GetSampleCount()), tags, map[string]string{"le": "+Inf"}).SetTime(fn(m.GetTimestampMs())))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "count"), float64(m.GetHistogram().GetSampleCount()), tags).SetTime(fn(m.GetTimestampMs())).SetType(types.Histogram))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "sum"), m.GetHistogram().GetSampleSum(), tags).SetTime(fn(m.GetTimestampMs())).SetType(types.Histogram))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), float64(m.GetHistogram().GetSampleCount()), tags, map[string]string{"le": "+Inf"}).SetTime(fn(m.GetTimestampMs())).SetType(types.Histogram))
 
 	for _, b := range m.GetHistogram().Bucket {
 		le := fmt.Sprint(b.GetUpperBound())
 		value := float64(b.GetCumulativeCount())
-		slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), value, tags, map[string]string{"le": le}).SetTime(fn(m.GetTimestampMs())))
+		slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), value, tags, map[string]string{"le": le}).SetTime(fn(m.GetTimestampMs())).SetType(types.Histogram))
 	}
 }
 
+// IsNativeHistogram reports whether the histogram carries sparse buckets
+func IsNativeHistogram(h *dto.Histogram) bool {
+	return h != nil && (h.Schema != nil || h.ZeroThreshold != nil ||
+		len(h.PositiveSpan) > 0 || len(h.NegativeSpan) > 0)
+}
+
+// NativeHistogram converts the sparse buckets of a histogram to prompb.Histogram
+func NativeHistogram(h *dto.Histogram) *prompb.Histogram {
+	ph := &prompb.Histogram{
+		Sum:            h.GetSampleSum(),
+		Schema:         h.GetSchema(),
+		ZeroThreshold:  h.GetZeroThreshold(),
+		NegativeSpans:  convertSpans(h.GetNegativeSpan()),
+		NegativeDeltas: h.GetNegativeDelta(),
+		NegativeCounts: h.GetNegativeCount(),
+		PositiveSpans:  convertSpans(h.GetPositiveSpan()),
+		PositiveDeltas: h.GetPositiveDelta(),
+		PositiveCounts: h.GetPositiveCount(),
+	}
+	if h.SampleCountFloat != nil {
+		ph.Count = &prompb.Histogram_CountFloat{CountFloat: h.GetSampleCountFloat()}
+		ph.ZeroCount = &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: h.GetZeroCountFloat()}
+	} else {
+		ph.Count = &prompb.Histogram_CountInt{CountInt: h.GetSampleCount()}
+		ph.ZeroCount = &prompb.Histogram_ZeroCountInt{ZeroCountInt: h.GetZeroCount()}
+	}
+	return ph
+}
+
+func convertSpans(spans []*dto.BucketSpan) []*prompb.BucketSpan {
+	if len(spans) == 0 {
+		return nil
+	}
+	ret := make([]*prompb.BucketSpan, 0, len(spans))
+	for _, s := range spans {
+		ret = append(ret, &prompb.BucketSpan{Offset: s.GetOffset(), Length: s.GetLength()})
+	}
+	return ret
+}
+
 func HandleGaugeCounter(defaultPrefix string, m *dto.Metric, tags map[string]string, metricName string, tf timeFn, slist *types.SampleList) {
 	fields := getNameAndValue(m, metricName)
 	fn := initTimeFn(tf)
+	typ := types.Untyped
+	switch {
+	case m.Gauge != nil:
+		typ = types.Gauge
+	case m.Counter != nil:
+		typ = types.Counter
+	}
 	for metric, value := range fields {
 		if !strings.HasPrefix(metric, defaultPrefix) {
-			slist.PushFront(types.NewSample("", prom.BuildMetric(defaultPrefix, metric, ""), value, tags).SetTime(fn(m.GetTimestampMs())))
+			slist.PushFront(types.NewSample("", prom.BuildMetric(defaultPrefix, metric, ""), value, tags).SetTime(fn(m.GetTimestampMs())).SetType(typ))
 		} else {
-			slist.PushFront(types.NewSample("", prom.BuildMetric("", metric, ""), value, tags).SetTime(fn(m.GetTimestampMs())))
+			slist.PushFront(types.NewSample("", prom.BuildMetric("", metric, ""), value, tags).SetTime(fn(m.GetTimestampMs())).SetType(typ))
 		}
 
 	}
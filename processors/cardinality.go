@@ -0,0 +1,149 @@
+package processors
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	defaultOverflowValue     = "__overflow__"
+	defaultCardinalityExpire = time.Hour
+)
+
+// cardinality limits the distinct values of labels per metric. Values beyond
+// the limit are replaced with an overflow value, or the sample is dropped.
+type cardinality struct {
+	sync.Mutex
+
+	labels   []string
+	limit    int
+	overflow string
+	drop     bool
+	expire   time.Duration
+
+	// metric -> label -> value -> last seen
+	values    map[string]map[string]map[string]time.Time
+	warned    map[string]struct{}
+	lastPurge time.Time
+}
+
+func init() {
+	Add("cardinality", newCardinality)
+}
+
+func newCardinality(opt config.ProcessorOption) (Processor, error) {
+	if opt.Limit <= 0 {
+		return nil, errors.New("limit must be greater than 0")
+	}
+	c := &cardinality{
+		labels:    opt.Labels,
+		limit:     opt.Limit,
+		overflow:  opt.OverflowValue,
+		drop:      opt.Drop,
+		expire:    time.Duration(opt.Expire),
+		values:    make(map[string]map[string]map[string]time.Time),
+		warned:    make(map[string]struct{}),
+		lastPurge: time.Now(),
+	}
+	if c.overflow == "" {
+		c.overflow = defaultOverflowValue
+	}
+	if c.expire <= 0 {
+		c.expire = defaultCardinalityExpire
+	}
+	return c, nil
+}
+
+func (c *cardinality) Process(samples []*types.Sample) []*types.Sample {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.purge(now)
+
+	ret := samples[:0]
+	for _, s := range samples {
+		if c.admit(s, now) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// admit records the label values of s, it returns false if s should be dropped
+func (c *cardinality) admit(s *types.Sample, now time.Time) bool {
+	metric, has := c.values[s.Metric]
+	if !has {
+		metric = make(map[string]map[string]time.Time)
+		c.values[s.Metric] = metric
+	}
+
+	check := func(label, value string) bool {
+		seen, has := metric[label]
+		if !has {
+			seen = make(map[string]time.Time)
+			metric[label] = seen
+		}
+		if _, has := seen[value]; has || len(seen) < c.limit {
+			seen[value] = now
+			return true
+		}
+		key := s.Metric + "/" + label
+		if _, has := c.warned[key]; !has {
+			c.warned[key] = struct{}{}
+			log.Printf("W! processor cardinality: label %s of metric %s exceeds %d values", label, s.Metric, c.limit)
+		}
+		return false
+	}
+
+	if len(c.labels) == 0 {
+		for label, value := range s.Labels {
+			if !check(label, value) {
+				if c.drop {
+					return false
+				}
+				s.Labels[label] = c.overflow
+			}
+		}
+		return true
+	}
+
+	for _, label := range c.labels {
+		value, has := s.Labels[label]
+		if !has || check(label, value) {
+			continue
+		}
+		if c.drop {
+			return false
+		}
+		s.Labels[label] = c.overflow
+	}
+	return true
+}
+
+func (c *cardinality) purge(now time.Time) {
+	if now.Sub(c.lastPurge) < c.expire/10 {
+		return
+	}
+	for name, metric := range c.values {
+		for label, seen := range metric {
+			for value, ts := range seen {
+				if now.Sub(ts) > c.expire {
+					delete(seen, value)
+				}
+			}
+			if len(seen) == 0 {
+				delete(metric, label)
+			}
+		}
+		if len(metric) == 0 {
+			delete(c.values, name)
+		}
+	}
+	c.lastPurge = now
+}
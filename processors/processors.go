@@ -0,0 +1,83 @@
+package processors
+
+import (
+	"fmt"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/types"
+)
+
+// Processor transforms samples of all inputs before they are written, Process
+// is called by many inputs at the same time
+type Processor interface {
+	Process(samples []*types.Sample) []*types.Sample
+}
+
+type Creator func(opt config.ProcessorOption) (Processor, error)
+
+var ProcessorCreators = map[string]Creator{}
+
+// Add registers a processor type, it is referred by `type` of [[processors]]
+func Add(typ string, creator Creator) {
+	ProcessorCreators[typ] = creator
+}
+
+// filtered applies a processor to the samples whose metric name matches
+type filtered struct {
+	filter    filter.Filter
+	processor Processor
+}
+
+func (f *filtered) Process(samples []*types.Sample) []*types.Sample {
+	matched := make([]*types.Sample, 0, len(samples))
+	ret := make([]*types.Sample, 0, len(samples))
+	for _, s := range samples {
+		if f.filter.Match(s.Metric) {
+			matched = append(matched, s)
+		} else {
+			ret = append(ret, s)
+		}
+	}
+	if len(matched) == 0 {
+		return ret
+	}
+	return append(ret, f.processor.Process(matched)...)
+}
+
+var chain []Processor
+
+// Init builds the global processor chain from [[processors]] of config.toml
+func Init() error {
+	chain = chain[:0]
+	for i, opt := range config.Config.Processors {
+		creator, has := ProcessorCreators[opt.Type]
+		if !has {
+			return fmt.Errorf("processor type %s not supported", opt.Type)
+		}
+		p, err := creator(opt)
+		if err != nil {
+			return fmt.Errorf("failed to create processor #%d(%s): %v", i, opt.Type, err)
+		}
+		if len(opt.Metrics) > 0 {
+			f, err := filter.Compile(opt.Metrics)
+			if err != nil {
+				return fmt.Errorf("processor #%d(%s) metrics: %v", i, opt.Type, err)
+			}
+			p = &filtered{filter: f, processor: p}
+		}
+		chain = append(chain, p)
+	}
+	return nil
+}
+
+// Process runs samples through the processor chain in order
+func Process(samples []*types.Sample) []*types.Sample {
+	for _, p := range chain {
+		if len(samples) == 0 {
+			break
+		}
+		samples = p.Process(samples)
+	}
+	return samples
+}
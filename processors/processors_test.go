@@ -0,0 +1,99 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func initChain(t *testing.T, opts ...config.ProcessorOption) {
+	config.Config = &config.ConfigType{Processors: opts}
+	require.NoError(t, Init())
+}
+
+func TestChain(t *testing.T) {
+	initChain(t,
+		config.ProcessorOption{Type: "rename", MetricRenames: map[string]string{"mem_used": "memory_used"}},
+		config.ProcessorOption{Type: "regex", Label: "url", Regex: "https?://([^/]+).*", TargetLabel: "domain"},
+		config.ProcessorOption{Type: "scale", Metrics: []string{"memory_*"}, FromUnit: "b", ToUnit: "kib"},
+	)
+
+	ss := Process([]*types.Sample{
+		types.NewSample("", "mem_used", 2048, map[string]string{"url": "https://example.com/a"}),
+		types.NewSample("", "cpu_idle", 2048),
+	})
+	require.Len(t, ss, 2)
+	byName := map[string]*types.Sample{}
+	for _, s := range ss {
+		byName[s.Metric] = s
+	}
+	require.Equal(t, 2.0, byName["memory_used"].Value)
+	require.Equal(t, "example.com", byName["memory_used"].Labels["domain"])
+	require.Equal(t, 2048, byName["cpu_idle"].Value)
+}
+
+func TestUnknownType(t *testing.T) {
+	config.Config = &config.ConfigType{Processors: []config.ProcessorOption{{Type: "nope"}}}
+	require.Error(t, Init())
+}
+
+func TestRate(t *testing.T) {
+	initChain(t, config.ProcessorOption{Type: "rate"})
+
+	now := time.Now()
+	counter := func(v float64, ts time.Time) []*types.Sample {
+		return []*types.Sample{
+			types.NewSample("", "requests_total", v).SetTime(ts).SetType(types.Counter),
+			types.NewSample("", "temperature", 30).SetTime(ts).SetType(types.Gauge),
+		}
+	}
+
+	ss := Process(counter(100, now))
+	require.Len(t, ss, 1)
+	require.Equal(t, "temperature", ss[0].Metric)
+
+	ss = Process(counter(110, now.Add(10*time.Second)))
+	require.Len(t, ss, 2)
+	require.Equal(t, "requests_total_rate", ss[0].Metric)
+	require.Equal(t, 1.0, ss[0].Value)
+}
+
+func TestCardinality(t *testing.T) {
+	initChain(t, config.ProcessorOption{Type: "cardinality", Labels: []string{"path"}, Limit: 2})
+
+	var ss []*types.Sample
+	for _, path := range []string{"/a", "/b", "/c", "/a"} {
+		ss = append(ss, types.NewSample("", "http_requests", 1, map[string]string{"path": path}))
+	}
+	ss = Process(ss)
+	require.Len(t, ss, 4)
+	require.Equal(t, "/a", ss[0].Labels["path"])
+	require.Equal(t, "/b", ss[1].Labels["path"])
+	require.Equal(t, defaultOverflowValue, ss[2].Labels["path"])
+	require.Equal(t, "/a", ss[3].Labels["path"])
+}
+
+func TestProcessSeries(t *testing.T) {
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "mem_used"}, {Name: "host", Value: "a"}},
+		Samples: []prompb.Sample{{Value: 2048, Timestamp: 1700000000000}},
+	}}
+
+	// passed through without processors
+	initChain(t)
+	require.Equal(t, series, ProcessSeries(series))
+
+	initChain(t,
+		config.ProcessorOption{Type: "rename", MetricRenames: map[string]string{"mem_used": "memory_used"}},
+		config.ProcessorOption{Type: "scale", Metrics: []string{"memory_*"}, FromUnit: "b", ToUnit: "kib"},
+	)
+	require.Equal(t, []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "memory_used"}, {Name: "host", Value: "a"}},
+		Samples: []prompb.Sample{{Value: 2, Timestamp: 1700000000000}},
+	}}, ProcessSeries(series))
+}
@@ -0,0 +1,82 @@
+package processors
+
+import (
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/derive"
+	"flashcat.cloud/categraf/types"
+)
+
+// rate turns counters into per-second rates or deltas between two gathers. Without
+// metrics it only applies to samples typed as counter.
+type rate struct {
+	delta        bool
+	suffix       string
+	keepOriginal bool
+	countersOnly bool
+	tracker      *derive.Tracker
+}
+
+func init() {
+	Add("rate", newRate)
+	Add("delta", newRate)
+}
+
+func newRate(opt config.ProcessorOption) (Processor, error) {
+	r := &rate{
+		delta:        opt.Type == "delta",
+		suffix:       opt.Suffix,
+		keepOriginal: opt.KeepOriginal,
+		countersOnly: len(opt.Metrics) == 0,
+		tracker:      derive.NewTracker(0),
+	}
+	if r.suffix == "" {
+		r.suffix = "_" + opt.Type
+	}
+	return r, nil
+}
+
+func (r *rate) Process(samples []*types.Sample) []*types.Sample {
+	ret := make([]*types.Sample, 0, len(samples))
+	for _, s := range samples {
+		if r.countersOnly && s.Type != types.Counter {
+			ret = append(ret, s)
+			continue
+		}
+		v, err := conv.ToFloat64(s.Value)
+		if err != nil {
+			ret = append(ret, s)
+			continue
+		}
+		if r.keepOriginal {
+			ret = append(ret, s)
+		}
+
+		ts := s.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		var (
+			value float64
+			ok    bool
+		)
+		if r.delta {
+			value, _, ok = r.tracker.Delta(s.SeriesKey(), v, ts)
+		} else {
+			value, ok = r.tracker.Rate(s.SeriesKey(), v, ts)
+		}
+		if !ok {
+			continue
+		}
+
+		ns := types.NewSample("", s.Metric+r.suffix, value, s.Labels).SetTime(s.Timestamp)
+		ns.Suppressed = s.Suppressed
+		if !r.delta {
+			ns.SetType(types.Gauge)
+		}
+		ret = append(ret, ns)
+	}
+	return ret
+}
@@ -0,0 +1,84 @@
+package processors
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/common/model"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+// regex rewrites a label, or the metric name with label __name__, matching a
+// regular expression. The whole value must match, like relabel_configs.
+type regex struct {
+	label       string
+	target      string
+	regex       *regexp.Regexp
+	replacement string
+}
+
+func init() {
+	Add("regex", newRegex)
+}
+
+func newRegex(opt config.ProcessorOption) (Processor, error) {
+	if opt.Regex == "" {
+		return nil, fmt.Errorf("regex is empty")
+	}
+	re, err := regexp.Compile("^(?:" + opt.Regex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("regex %s compile error: %v", opt.Regex, err)
+	}
+
+	r := &regex{
+		label:       opt.Label,
+		target:      opt.TargetLabel,
+		regex:       re,
+		replacement: opt.Replacement,
+	}
+	if r.label == "" {
+		r.label = model.MetricNameLabel
+	}
+	if r.target == "" {
+		r.target = r.label
+	}
+	if r.replacement == "" {
+		r.replacement = "$1"
+	}
+	return r, nil
+}
+
+func (r *regex) Process(samples []*types.Sample) []*types.Sample {
+	for _, s := range samples {
+		var value string
+		if r.label == model.MetricNameLabel {
+			value = s.Metric
+		} else {
+			v, has := s.Labels[r.label]
+			if !has {
+				continue
+			}
+			value = v
+		}
+
+		match := r.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			continue
+		}
+		res := string(r.regex.ExpandString(nil, r.replacement, value, match))
+		if r.target == model.MetricNameLabel {
+			if res != "" {
+				s.Metric = res
+			}
+			continue
+		}
+		if res == "" {
+			delete(s.Labels, r.target)
+		} else {
+			s.Labels[r.target] = res
+		}
+	}
+	return samples
+}
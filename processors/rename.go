@@ -0,0 +1,40 @@
+package processors
+
+import (
+	"errors"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+// rename changes metric names and label names
+type rename struct {
+	metrics map[string]string
+	labels  map[string]string
+}
+
+func init() {
+	Add("rename", newRename)
+}
+
+func newRename(opt config.ProcessorOption) (Processor, error) {
+	if len(opt.MetricRenames) == 0 && len(opt.LabelRenames) == 0 {
+		return nil, errors.New("metric_renames and label_renames are both empty")
+	}
+	return &rename{metrics: opt.MetricRenames, labels: opt.LabelRenames}, nil
+}
+
+func (r *rename) Process(samples []*types.Sample) []*types.Sample {
+	for _, s := range samples {
+		if name, has := r.metrics[s.Metric]; has {
+			s.Metric = name
+		}
+		for from, to := range r.labels {
+			if v, has := s.Labels[from]; has {
+				delete(s.Labels, from)
+				s.Labels[to] = v
+			}
+		}
+	}
+	return samples
+}
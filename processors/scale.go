@@ -0,0 +1,80 @@
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/types"
+)
+
+type unit struct {
+	kind  string
+	ratio float64
+}
+
+// units known by from_unit and to_unit, ratio is relative to seconds and bytes
+var units = map[string]unit{
+	"ns": {"time", 1e-9},
+	"us": {"time", 1e-6},
+	"ms": {"time", 1e-3},
+	"s":  {"time", 1},
+	"m":  {"time", 60},
+	"h":  {"time", 3600},
+	"d":  {"time", 86400},
+
+	"bit": {"size", 0.125},
+	"b":   {"size", 1},
+	"kb":  {"size", 1e3},
+	"mb":  {"size", 1e6},
+	"gb":  {"size", 1e9},
+	"tb":  {"size", 1e12},
+	"kib": {"size", 1 << 10},
+	"mib": {"size", 1 << 20},
+	"gib": {"size", 1 << 30},
+	"tib": {"size", 1 << 40},
+}
+
+// scale converts values with value * factor + offset
+type scale struct {
+	factor float64
+	offset float64
+}
+
+func init() {
+	Add("scale", newScale)
+}
+
+func newScale(opt config.ProcessorOption) (Processor, error) {
+	s := &scale{factor: opt.Factor, offset: opt.Offset}
+	if opt.FromUnit != "" || opt.ToUnit != "" {
+		from, has := units[strings.ToLower(opt.FromUnit)]
+		if !has {
+			return nil, fmt.Errorf("unknown from_unit: %s", opt.FromUnit)
+		}
+		to, has := units[strings.ToLower(opt.ToUnit)]
+		if !has {
+			return nil, fmt.Errorf("unknown to_unit: %s", opt.ToUnit)
+		}
+		if from.kind != to.kind {
+			return nil, fmt.Errorf("can not convert %s to %s", opt.FromUnit, opt.ToUnit)
+		}
+		s.factor = from.ratio / to.ratio
+	}
+	if s.factor == 0 {
+		s.factor = 1
+	}
+	return s, nil
+}
+
+func (p *scale) Process(samples []*types.Sample) []*types.Sample {
+	for _, s := range samples {
+		v, err := conv.ToFloat64(s.Value)
+		if err != nil {
+			continue
+		}
+		s.Value = v*p.factor + p.offset
+	}
+	return samples
+}
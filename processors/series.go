@@ -0,0 +1,66 @@
+package processors
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/types"
+)
+
+// ProcessSeries runs series pushed in prometheus format through the processor chain. They are
+// converted to samples and back only if there are processors, series are passed through otherwise.
+func ProcessSeries(series []prompb.TimeSeries) []prompb.TimeSeries {
+	if len(chain) == 0 || len(series) == 0 {
+		return series
+	}
+
+	samples := make([]*types.Sample, 0, len(series))
+	for _, ts := range series {
+		var name string
+		labels := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			labels[l.Name] = l.Value
+		}
+		for _, s := range ts.Samples {
+			samples = append(samples, &types.Sample{
+				Metric:    name,
+				Labels:    copyLabels(labels),
+				Value:     s.Value,
+				Timestamp: time.UnixMilli(s.Timestamp),
+			})
+		}
+		for i := range ts.Histograms {
+			h := ts.Histograms[i]
+			samples = append(samples, &types.Sample{
+				Metric:    name,
+				Labels:    copyLabels(labels),
+				Timestamp: time.UnixMilli(h.Timestamp),
+				Type:      types.Histogram,
+				Histogram: &h,
+			})
+		}
+	}
+
+	samples = Process(samples)
+	ret := make([]prompb.TimeSeries, 0, len(samples))
+	for _, s := range samples {
+		if ts := s.ConvertTimeSeries(""); ts != nil {
+			ret = append(ret, *ts)
+		}
+	}
+	return ret
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	ret := make(map[string]string, len(labels))
+	for k, v := range labels {
+		ret[k] = v
+	}
+	return ret
+}
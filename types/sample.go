@@ -22,6 +22,18 @@ type (
 		Timestamp time.Time         `json:"timestamp"`
 		Value     interface{}       `json:"value"`
 		Labels    map[string]string `json:"labels"`
+
+		// optional metadata, only writers speaking remote write 2.0 use them
+		Type    ValueType `json:"type,omitempty"`
+		Help    string    `json:"help,omitempty"`
+		Unit    string    `json:"unit,omitempty"`
+		Created time.Time `json:"created,omitempty"`
+
+		// Histogram is set for native histograms, Value is ignored then
+		Histogram *prompb.Histogram `json:"histogram,omitempty"`
+
+		// Suppressed is set by dedup on unchanged samples, they are exposed but not written
+		Suppressed bool `json:"-"`
 	}
 )
 
@@ -54,12 +66,6 @@ func NewSample(prefix, metric string, value interface{}, labels ...map[string]st
 }
 
 func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
-	value, err := conv.ToFloat64(item.Value)
-	if err != nil {
-		// If the Labels is empty, it means it is abnormal data
-		return nil
-	}
-
 	pt := prompb.TimeSeries{}
 
 	timestamp := item.Timestamp.UnixMilli()
@@ -71,10 +77,22 @@ func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
 		timestamp = ts - ts%60000
 	}
 
-	pt.Samples = append(pt.Samples, prompb.Sample{
-		Timestamp: timestamp,
-		Value:     value,
-	})
+	if item.Histogram != nil {
+		h := *item.Histogram
+		h.Timestamp = timestamp
+		pt.Histograms = append(pt.Histograms, h)
+	} else {
+		value, err := conv.ToFloat64(item.Value)
+		if err != nil {
+			// If the Labels is empty, it means it is abnormal data
+			return nil
+		}
+
+		pt.Samples = append(pt.Samples, prompb.Sample{
+			Timestamp: timestamp,
+			Value:     value,
+		})
+	}
 
 	// add label: metric
 	pt.Labels = append(pt.Labels, prompb.Label{
@@ -105,6 +123,25 @@ func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
 	return &pt
 }
 
+// SeriesKey identifies the series of a sample by its metric name and labels
+func (s *Sample) SeriesKey() string {
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(s.Metric)
+	for _, k := range keys {
+		sb.WriteByte('\xff')
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(s.Labels[k])
+	}
+	return sb.String()
+}
+
 func (s *Sample) SetTime(t time.Time) *Sample {
 	if t.IsZero() || zeroTime.Equal(t) {
 		return s
@@ -112,3 +149,8 @@ func (s *Sample) SetTime(t time.Time) *Sample {
 	s.Timestamp = t
 	return s
 }
+
+func (s *Sample) SetType(t ValueType) *Sample {
+	s.Type = t
+	return s
+}
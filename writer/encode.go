@@ -0,0 +1,96 @@
+package writer
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// jsonSample is the json form of one sample, used by kafka and file writers
+type jsonSample struct {
+	Metric    string            `json:"metric"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// splitLabels returns the metric name and the other labels of a series
+func splitLabels(ts prompb.TimeSeries) (string, map[string]string) {
+	var name string
+	labels := make(map[string]string, len(ts.Labels))
+	for _, l := range ts.Labels {
+		if l.Name == model.MetricNameLabel {
+			name = l.Value
+			continue
+		}
+		labels[l.Name] = l.Value
+	}
+	return name, labels
+}
+
+func validValue(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// encodeJSON returns one json document per sample, NaN and Inf can not be represented and are skipped
+func encodeJSON(items []prompb.TimeSeries) ([][]byte, error) {
+	ret := make([][]byte, 0, len(items))
+	for _, ts := range items {
+		name, labels := splitLabels(ts)
+		for _, s := range ts.Samples {
+			if !validValue(s.Value) {
+				continue
+			}
+			bs, err := json.Marshal(jsonSample{
+				Metric:    name,
+				Labels:    labels,
+				Value:     s.Value,
+				Timestamp: s.Timestamp,
+			})
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, bs)
+		}
+	}
+	return ret, nil
+}
+
+// encodeInflux returns influx line protocol with nanosecond timestamps, metric name is
+// the measurement and the sample value is the field "value". Lines can not be encoded are skipped
+func encodeInflux(items []prompb.TimeSeries) []byte {
+	var enc lineprotocol.Encoder
+	enc.SetPrecision(lineprotocol.Nanosecond)
+
+	keys := make([]string, 0, 16)
+	for _, ts := range items {
+		name, labels := splitLabels(ts)
+		keys = keys[:0]
+		for k, v := range labels {
+			if k == "" || v == "" {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, s := range ts.Samples {
+			value, ok := lineprotocol.FloatValue(s.Value)
+			if !ok {
+				continue
+			}
+			enc.StartLine(name)
+			for _, k := range keys {
+				enc.AddTag(k, labels[k])
+			}
+			enc.AddField("value", value)
+			enc.EndLine(time.UnixMilli(s.Timestamp))
+		}
+	}
+	return enc.Bytes()
+}
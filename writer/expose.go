@@ -0,0 +1,192 @@
+package writer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/proto"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+const exposePurgePeriod = time.Minute
+
+// exposedSeries is the latest value of a series gathered by an input
+type exposedSeries struct {
+	input  string
+	labels []prompb.Label
+	value  float64
+	typ    types.ValueType
+	help   string
+	// the series is stale once it is not gathered again before expire
+	expire time.Time
+}
+
+// exposeStore keeps the latest value of every series gathered by inputs, it backs
+// the /metrics endpoint of the http server
+type exposeStore struct {
+	sync.RWMutex
+	series    map[uint64]*exposedSeries
+	lastPurge time.Time
+}
+
+var exposed *exposeStore
+
+func newExposeStore() *exposeStore {
+	return &exposeStore{
+		series:    make(map[uint64]*exposedSeries),
+		lastPurge: time.Now(),
+	}
+}
+
+// initExpose enables the latest value store if [http] expose_metrics is on
+func initExpose() {
+	if conf := config.Config.HTTP; conf != nil && conf.Enable && conf.ExposeMetrics && !config.Config.TestMode {
+		exposed = newExposeStore()
+	}
+}
+
+// Expose remembers the samples gathered by input, they are dropped after
+// expose_stale_intervals times interval without being gathered again
+func Expose(input string, interval time.Duration, samples []*types.Sample) {
+	if exposed == nil || len(samples) == 0 {
+		return
+	}
+	ttl := interval * time.Duration(config.Config.HTTP.ExposeStaleIntervals)
+	exposed.update(input, ttl, samples, time.Now())
+}
+
+func (es *exposeStore) update(input string, ttl time.Duration, samples []*types.Sample, now time.Time) {
+	expire := now.Add(ttl)
+	entries := make([]*exposedSeries, 0, len(samples))
+	for _, sample := range samples {
+		// native histograms can not be rendered in text formats
+		if sample.Histogram != nil || !model.IsValidMetricName(model.LabelValue(sample.Metric)) {
+			continue
+		}
+		ts := sample.ConvertTimeSeries(config.Config.Global.Precision)
+		if ts == nil || len(ts.Samples) == 0 {
+			continue
+		}
+		entries = append(entries, &exposedSeries{
+			input:  input,
+			labels: ts.Labels,
+			value:  ts.Samples[0].Value,
+			typ:    sample.Type,
+			help:   sample.Help,
+			expire: expire,
+		})
+	}
+
+	es.Lock()
+	defer es.Unlock()
+	for _, e := range entries {
+		es.series[seriesHash(e.labels)] = e
+	}
+	if now.Sub(es.lastPurge) > exposePurgePeriod {
+		for k, e := range es.series {
+			if now.After(e.expire) {
+				delete(es.series, k)
+			}
+		}
+		es.lastPurge = now
+	}
+}
+
+// GatherExposed returns the fresh series of the inputs accepted by match as metric families
+func GatherExposed(match func(input string) bool) []*dto.MetricFamily {
+	if exposed == nil {
+		return nil
+	}
+	return exposed.gather(match, time.Now())
+}
+
+func (es *exposeStore) gather(match func(input string) bool, now time.Time) []*dto.MetricFamily {
+	groups := make(map[string][]*exposedSeries)
+	es.RLock()
+	for _, e := range es.series {
+		if now.After(e.expire) || (match != nil && !match(e.input)) {
+			continue
+		}
+		name := e.labels[0].Value
+		groups[name] = append(groups[name], e)
+	}
+	es.RUnlock()
+
+	families := make([]*dto.MetricFamily, 0, len(groups))
+	for name, entries := range groups {
+		families = append(families, buildFamily(name, entries))
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families
+}
+
+// buildFamily renders series sharing a name, counters and gauges keep their type,
+// the rest (including exploded histograms and summaries) are untyped
+func buildFamily(name string, entries []*exposedSeries) *dto.MetricFamily {
+	typ := entries[0].typ
+	help := ""
+	for _, e := range entries {
+		if e.typ != typ {
+			typ = types.Untyped
+		}
+		if help == "" {
+			help = e.help
+		}
+	}
+	mtype := dto.MetricType_UNTYPED
+	switch typ {
+	case types.Counter:
+		mtype = dto.MetricType_COUNTER
+	case types.Gauge:
+		mtype = dto.MetricType_GAUGE
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return labelsLess(entries[i].labels, entries[j].labels)
+	})
+
+	mf := &dto.MetricFamily{
+		Name:   proto.String(name),
+		Type:   mtype.Enum(),
+		Metric: make([]*dto.Metric, 0, len(entries)),
+	}
+	if help != "" {
+		mf.Help = proto.String(help)
+	}
+	for _, e := range entries {
+		m := &dto.Metric{Label: make([]*dto.LabelPair, 0, len(e.labels)-1)}
+		for _, l := range e.labels[1:] {
+			m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+		}
+		switch mtype {
+		case dto.MetricType_COUNTER:
+			m.Counter = &dto.Counter{Value: proto.Float64(e.value)}
+		case dto.MetricType_GAUGE:
+			m.Gauge = &dto.Gauge{Value: proto.Float64(e.value)}
+		default:
+			m.Untyped = &dto.Untyped{Value: proto.Float64(e.value)}
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+	return mf
+}
+
+func labelsLess(a, b []prompb.Label) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Name != b[i].Name {
+			return a[i].Name < b[i].Name
+		}
+		if a[i].Value != b[i].Value {
+			return a[i].Value < b[i].Value
+		}
+	}
+	return len(a) < len(b)
+}
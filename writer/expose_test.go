@@ -0,0 +1,46 @@
+package writer
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestExposeStore(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	es := newExposeStore()
+	now := time.Now()
+
+	invalid := types.NewSample("", "invalid", 1)
+	invalid.Metric = "invalid-name"
+	es.update("cpu", time.Minute, []*types.Sample{
+		types.NewSample("cpu", "usage_idle", 90, map[string]string{"cpu": "cpu0"}).SetType(types.Gauge),
+		types.NewSample("cpu", "usage_idle", 80, map[string]string{"cpu": "cpu1"}).SetType(types.Gauge),
+		invalid,
+	}, now)
+	es.update("net", time.Second, []*types.Sample{
+		types.NewSample("net", "bytes_recv", 10).SetType(types.Counter),
+	}, now)
+
+	families := es.gather(nil, now)
+	require.Len(t, families, 2)
+	require.Equal(t, "cpu_usage_idle", families[0].GetName())
+	require.Equal(t, dto.MetricType_GAUGE, families[0].GetType())
+	require.Len(t, families[0].Metric, 2)
+	require.Equal(t, "cpu0", families[0].Metric[0].Label[0].GetValue())
+	require.Equal(t, dto.MetricType_COUNTER, families[1].GetType())
+
+	families = es.gather(func(input string) bool { return input == "net" }, now)
+	require.Len(t, families, 1)
+	require.Equal(t, "net_bytes_recv", families[0].GetName())
+
+	// net is stale after its interval has passed
+	families = es.gather(nil, now.Add(2*time.Second))
+	require.Len(t, families, 1)
+	require.Equal(t, "cpu_usage_idle", families[0].GetName())
+}
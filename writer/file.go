@@ -0,0 +1,78 @@
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// FileWriter appends series to a local file or stdout, it is mainly for debugging
+type FileWriter struct {
+	sync.Mutex
+
+	format string
+	out    io.Writer
+}
+
+func init() {
+	Add("file", newFileWriter)
+}
+
+func newFileWriter(opt config.WriterOption) (Writer, error) {
+	if opt.Path == "" {
+		return nil, errors.New("file writer: path is required")
+	}
+	w := &FileWriter{format: opt.Format}
+	switch w.format {
+	case "":
+		w.format = "json"
+	case "json", "influx":
+	default:
+		return nil, fmt.Errorf("file writer: unsupported format %s", opt.Format)
+	}
+
+	switch opt.Path {
+	case "stdout":
+		w.out = os.Stdout
+	case "stderr":
+		w.out = os.Stderr
+	default:
+		f, err := os.OpenFile(opt.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		w.out = f
+	}
+	return w, nil
+}
+
+func (w *FileWriter) Write(items []prompb.TimeSeries) error {
+	var data []byte
+	switch w.format {
+	case "influx":
+		data = encodeInflux(items)
+	default:
+		docs, err := encodeJSON(items)
+		if err != nil {
+			return &PermanentError{Err: err}
+		}
+		var buf bytes.Buffer
+		for _, doc := range docs {
+			buf.Write(doc)
+			buf.WriteByte('\n')
+		}
+		data = buf.Bytes()
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	_, err := w.out.Write(data)
+	return err
+}
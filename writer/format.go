@@ -0,0 +1,73 @@
+package writer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+// formats of FormatSamples
+const (
+	FormatJSON       = "json"
+	FormatPrometheus = "prometheus"
+	FormatInflux     = "influx"
+)
+
+// ValidFormat returns whether FormatSamples knows the format
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatPrometheus, FormatInflux:
+		return true
+	}
+	return false
+}
+
+// FormatSamples writes samples to w in the format: a json array, prometheus text exposition
+// or influx line protocol. Samples are converted the way they are written to writers.
+func FormatSamples(w io.Writer, format string, samples []*types.Sample) error {
+	switch format {
+	case FormatJSON:
+		items := convertSamples(samples)
+		docs, err := encodeJSON(items)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(append([]byte{'['}, bytes.Join(docs, []byte{','})...), ']'))
+		return err
+	case FormatPrometheus:
+		// the expose store groups series into families the way /metrics does
+		es := newExposeStore()
+		now := time.Now()
+		es.update("", time.Minute, samples, now)
+		for _, mf := range es.gather(nil, now) {
+			if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatInflux:
+		_, err := w.Write(encodeInflux(convertSamples(samples)))
+		return err
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func convertSamples(samples []*types.Sample) []prompb.TimeSeries {
+	items := make([]prompb.TimeSeries, 0, len(samples))
+	for _, sample := range samples {
+		item := sample.ConvertTimeSeries(config.Config.Global.Precision)
+		if item == nil || len(item.Labels) == 0 {
+			continue
+		}
+		items = append(items, *item)
+	}
+	return items
+}
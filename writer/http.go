@@ -0,0 +1,96 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// httpWriter holds what all http based writers share: transport, tls, auth and custom headers
+type httpWriter struct {
+	Opts   config.WriterOption
+	Client api.Client
+}
+
+func newHTTPWriter(opt config.WriterOption) (*httpWriter, error) {
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
+		}).DialContext,
+		ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
+		MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
+	}
+	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
+		opt.UseTLS = true
+		tlsConfig, err := opt.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+	cli, err := api.NewClient(api.Config{
+		Address:      opt.Url,
+		RoundTripper: tr,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpWriter{
+		Opts:   opt,
+		Client: cli,
+	}, nil
+}
+
+// post sends body to the configured url, headers are set before the user defined ones
+func (w *httpWriter) post(body []byte, headers map[string]string) error {
+	httpReq, err := http.NewRequest("POST", w.Opts.Url, bytes.NewReader(body))
+	if err != nil {
+		log.Println("W! create write request got error:", err)
+		return err
+	}
+
+	httpReq.Header.Set("User-Agent", "categraf")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	for i := 0; i < len(w.Opts.Headers); i += 2 {
+		httpReq.Header.Add(w.Opts.Headers[i], w.Opts.Headers[i+1])
+		if w.Opts.Headers[i] == "Host" {
+			httpReq.Host = w.Opts.Headers[i+1]
+		}
+	}
+
+	if w.Opts.BasicAuthUser != "" {
+		httpReq.SetBasicAuth(w.Opts.BasicAuthUser, w.Opts.BasicAuthPass)
+	}
+
+	resp, respBody, err := w.Client.Do(context.Background(), httpReq)
+	if err != nil {
+		if config.Config.DebugMode {
+			log.Println("D! push data to", w.Opts.Url, "got error:", err, "response body:", string(respBody))
+		}
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return &statusError{
+			code:       resp.StatusCode,
+			body:       string(respBody),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return nil
+}
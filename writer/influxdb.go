@@ -0,0 +1,36 @@
+package writer
+
+import (
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// InfluxDBWriter posts influx line protocol to url, e.g.
+// http://127.0.0.1:8086/write?db=categraf or http://127.0.0.1:8086/api/v2/write?org=x&bucket=y
+type InfluxDBWriter struct {
+	*httpWriter
+}
+
+func init() {
+	Add("influxdb", newInfluxDBWriter)
+}
+
+func newInfluxDBWriter(opt config.WriterOption) (Writer, error) {
+	hw, err := newHTTPWriter(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &InfluxDBWriter{httpWriter: hw}, nil
+}
+
+func (w *InfluxDBWriter) Write(items []prompb.TimeSeries) error {
+	data := encodeInflux(items)
+	if len(data) == 0 {
+		return nil
+	}
+
+	return w.post(data, map[string]string{
+		"Content-Type": "text/plain; charset=utf-8",
+	})
+}
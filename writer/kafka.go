@@ -0,0 +1,155 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/logs/client/kafka"
+)
+
+// KafkaWriter produces series to a kafka topic, one message per sample in json
+// format or one prompb.WriteRequest message per batch in protobuf format
+type KafkaWriter struct {
+	opt    config.WriterOption
+	config *sarama.Config
+
+	// connected on the first write, so that brokers down at startup do not stop the agent
+	lock     sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func init() {
+	Add("kafka", newKafkaWriter)
+}
+
+func newKafkaWriter(opt config.WriterOption) (Writer, error) {
+	if len(opt.Brokers) == 0 || opt.Topic == "" {
+		return nil, errors.New("kafka writer: brokers and topic are required")
+	}
+	switch opt.Format {
+	case "":
+		opt.Format = "json"
+	case "json", "protobuf":
+	default:
+		return nil, fmt.Errorf("kafka writer: unsupported format %s", opt.Format)
+	}
+
+	c, err := kafkaConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaWriter{opt: opt, config: c}, nil
+}
+
+// getProducer connects to the brokers unless connected, the error is retried with the batch
+func (w *KafkaWriter) getProducer() (sarama.SyncProducer, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.producer != nil {
+		return w.producer, nil
+	}
+	producer, err := sarama.NewSyncProducer(w.opt.Brokers, w.config)
+	if err != nil {
+		return nil, fmt.Errorf("kafka writer: failed to connect to %v: %v", w.opt.Brokers, err)
+	}
+	w.producer = producer
+	return producer, nil
+}
+
+// kafkaConfig returns the sarama config of opt
+func kafkaConfig(opt config.WriterOption) (*sarama.Config, error) {
+	c := sarama.NewConfig()
+	c.ClientID = "categraf"
+	c.Producer.Return.Successes = true
+	c.Producer.RequiredAcks = sarama.WaitForLocal
+	// retries are handled by the writer queue
+	c.Producer.Retry.Max = 0
+	if opt.Timeout > 0 {
+		c.Producer.Timeout = time.Duration(opt.Timeout) * time.Millisecond
+		c.Net.ReadTimeout = c.Producer.Timeout
+		c.Net.WriteTimeout = c.Producer.Timeout
+	}
+	if opt.DialTimeout > 0 {
+		c.Net.DialTimeout = time.Duration(opt.DialTimeout) * time.Millisecond
+	}
+	if opt.KafkaVersion != "" {
+		v, err := sarama.ParseKafkaVersion(opt.KafkaVersion)
+		if err != nil {
+			return nil, err
+		}
+		c.Version = v
+	}
+	if opt.SaslEnable {
+		c.Net.SASL.Enable = true
+		c.Net.SASL.User = opt.SaslUser
+		c.Net.SASL.Password = opt.SaslPassword
+		switch sarama.SASLMechanism(opt.SaslMechanism) {
+		case "", sarama.SASLTypePlaintext:
+			c.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			c.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafka.XDGSCRAMClient{HashGeneratorFcn: kafka.SHA256}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			c.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafka.XDGSCRAMClient{HashGeneratorFcn: kafka.SHA512}
+			}
+		default:
+			return nil, fmt.Errorf("kafka writer: unsupported sasl_mechanism %s, should be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", opt.SaslMechanism)
+		}
+	}
+	if opt.UseTLS {
+		tlsConfig, err := opt.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		c.Net.TLS.Enable = true
+		c.Net.TLS.Config = tlsConfig
+	}
+	return c, nil
+}
+
+func (w *KafkaWriter) Write(items []prompb.TimeSeries) error {
+	var msgs []*sarama.ProducerMessage
+	switch w.opt.Format {
+	case "protobuf":
+		data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: items})
+		if err != nil {
+			return &PermanentError{Err: err}
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: w.opt.Topic,
+			Value: sarama.ByteEncoder(data),
+		})
+	default:
+		docs, err := encodeJSON(items)
+		if err != nil {
+			return &PermanentError{Err: err}
+		}
+		msgs = make([]*sarama.ProducerMessage, 0, len(docs))
+		for _, doc := range docs {
+			msgs = append(msgs, &sarama.ProducerMessage{
+				Topic: w.opt.Topic,
+				Value: sarama.ByteEncoder(doc),
+			})
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	producer, err := w.getProducer()
+	if err != nil {
+		return err
+	}
+	return producer.SendMessages(msgs)
+}
@@ -0,0 +1,96 @@
+package writer
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	createdTTL  = time.Hour
+	purgePeriod = 10 * time.Minute
+	labelSep    = '\xff'
+)
+
+// familyMetadata is the TYPE/HELP/UNIT of a metric name
+type familyMetadata struct {
+	Type types.ValueType
+	Help string
+	Unit string
+}
+
+type createdEntry struct {
+	ts   int64
+	seen time.Time
+}
+
+// metadataStore remembers metadata of the samples passing WriteSamples, so that
+// writers speaking remote write 2.0 can attach it to the series they send
+type metadataStore struct {
+	sync.RWMutex
+	families  map[string]familyMetadata
+	created   map[uint64]createdEntry
+	lastPurge time.Time
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{
+		families:  make(map[string]familyMetadata),
+		created:   make(map[uint64]createdEntry),
+		lastPurge: time.Now(),
+	}
+}
+
+func seriesHash(labels []prompb.Label) uint64 {
+	h := fnv.New64a()
+	sep := []byte{labelSep}
+	for _, l := range labels {
+		h.Write([]byte(l.Name))
+		h.Write(sep)
+		h.Write([]byte(l.Value))
+		h.Write(sep)
+	}
+	return h.Sum64()
+}
+
+func (ms *metadataStore) update(sample *types.Sample, ts *prompb.TimeSeries) {
+	if sample.Type == 0 && sample.Help == "" && sample.Unit == "" && sample.Created.IsZero() {
+		return
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+	if sample.Type != 0 || sample.Help != "" || sample.Unit != "" {
+		ms.families[sample.Metric] = familyMetadata{Type: sample.Type, Help: sample.Help, Unit: sample.Unit}
+	}
+
+	now := time.Now()
+	if !sample.Created.IsZero() {
+		ms.created[seriesHash(ts.Labels)] = createdEntry{ts: sample.Created.UnixMilli(), seen: now}
+	}
+	if now.Sub(ms.lastPurge) > purgePeriod {
+		for k, v := range ms.created {
+			if now.Sub(v.seen) > createdTTL {
+				delete(ms.created, k)
+			}
+		}
+		ms.lastPurge = now
+	}
+}
+
+func (ms *metadataStore) family(name string) (familyMetadata, bool) {
+	ms.RLock()
+	defer ms.RUnlock()
+	m, has := ms.families[name]
+	return m, has
+}
+
+func (ms *metadataStore) createdTimestamp(labels []prompb.Label) int64 {
+	ms.RLock()
+	defer ms.RUnlock()
+	return ms.created[seriesHash(labels)].ts
+}
@@ -0,0 +1,63 @@
+package writer
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// OpenTSDBWriter posts series to OpenTSDB http api, url e.g. http://127.0.0.1:4242/api/put
+type OpenTSDBWriter struct {
+	*httpWriter
+}
+
+type openTSDBPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func init() {
+	Add("opentsdb", newOpenTSDBWriter)
+}
+
+func newOpenTSDBWriter(opt config.WriterOption) (Writer, error) {
+	hw, err := newHTTPWriter(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenTSDBWriter{httpWriter: hw}, nil
+}
+
+func (w *OpenTSDBWriter) Write(items []prompb.TimeSeries) error {
+	points := make([]openTSDBPoint, 0, len(items))
+	for _, ts := range items {
+		name, labels := splitLabels(ts)
+		for _, s := range ts.Samples {
+			if !validValue(s.Value) {
+				continue
+			}
+			points = append(points, openTSDBPoint{
+				Metric: name,
+				// 13 digits are treated as milliseconds by opentsdb
+				Timestamp: s.Timestamp,
+				Value:     s.Value,
+				Tags:      labels,
+			})
+		}
+	}
+	if len(points) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(points)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	return w.post(data, map[string]string{
+		"Content-Type": "application/json",
+	})
+}
@@ -0,0 +1,78 @@
+package writer
+
+import (
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// PrometheusWriter sends series with prometheus remote write protocol
+type PrometheusWriter struct {
+	*httpWriter
+}
+
+func init() {
+	Add("prometheus", newPrometheusWriter)
+}
+
+func newPrometheusWriter(opt config.WriterOption) (Writer, error) {
+	hw, err := newHTTPWriter(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &PrometheusWriter{httpWriter: hw}, nil
+}
+
+func (w *PrometheusWriter) Write(items []prompb.TimeSeries) error {
+	if w.Opts.RemoteWriteVersion == remoteWriteV2 {
+		return w.writeV2(items)
+	}
+
+	// native histograms are only sent with remote write 2.0
+	items = floatSeries(items)
+	if len(items) == 0 {
+		return nil
+	}
+	data, err := encodeRequest(items)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+
+	return w.post(data, map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+}
+
+func (w *PrometheusWriter) writeV2(items []prompb.TimeSeries) error {
+	data, err := encodeRequestV2(items, metadata)
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+
+	return w.post(snappy.Encode(nil, data), map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      remoteWriteV2ContentType,
+		"X-Prometheus-Remote-Write-Version": "2.0.0",
+	})
+}
+
+// floatSeries drops the series carrying nothing but histograms
+func floatSeries(items []prompb.TimeSeries) []prompb.TimeSeries {
+	for i := range items {
+		if len(items[i].Samples) > 0 {
+			continue
+		}
+		ret := make([]prompb.TimeSeries, 0, len(items))
+		ret = append(ret, items[:i]...)
+		for _, ts := range items[i+1:] {
+			if len(ts.Samples) > 0 {
+				ret = append(ret, ts)
+			}
+		}
+		return ret
+	}
+	return items
+}
@@ -0,0 +1,154 @@
+package writer
+
+import (
+	"math"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"flashcat.cloud/categraf/types"
+)
+
+// remote write 2.0, io.prometheus.write.v2.Request
+// https://prometheus.io/docs/specs/remote_write_spec_2_0/
+const (
+	remoteWriteV2            = "2.0"
+	remoteWriteV2ContentType = "application/x-protobuf;proto=io.prometheus.write.v2.Request"
+
+	// Request
+	fieldRequestSymbols    = 4
+	fieldRequestTimeseries = 5
+	// TimeSeries
+	fieldSeriesLabelsRefs = 1
+	fieldSeriesSamples    = 2
+	fieldSeriesHistograms = 3
+	fieldSeriesMetadata   = 5
+	fieldSeriesCreatedTs  = 6
+	// Sample
+	fieldSampleValue     = 1
+	fieldSampleTimestamp = 2
+	// Metadata
+	fieldMetadataType    = 1
+	fieldMetadataHelpRef = 3
+	fieldMetadataUnitRef = 4
+)
+
+// metadataType maps to io.prometheus.write.v2.Metadata.MetricType
+func metadataType(t types.ValueType) uint64 {
+	switch t {
+	case types.Counter:
+		return 1
+	case types.Gauge:
+		return 2
+	case types.Histogram:
+		return 3
+	case types.Summary:
+		return 5
+	}
+	return 0
+}
+
+// symbolTable interns strings, the first symbol must be empty
+type symbolTable struct {
+	refs    map[string]uint32
+	symbols []string
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{
+		refs:    map[string]uint32{"": 0},
+		symbols: []string{""},
+	}
+}
+
+func (st *symbolTable) ref(s string) uint32 {
+	if r, has := st.refs[s]; has {
+		return r
+	}
+	r := uint32(len(st.symbols))
+	st.refs[s] = r
+	st.symbols = append(st.symbols, s)
+	return r
+}
+
+// encodeRequestV2 marshals items to a remote write 2.0 request, metadata and created
+// timestamps are looked up in md. The histogram message of 2.0 keeps the field numbers
+// of prompb.Histogram, so it is marshaled as is.
+func encodeRequestV2(items []prompb.TimeSeries, md *metadataStore) ([]byte, error) {
+	st := newSymbolTable()
+	series := make([][]byte, 0, len(items))
+
+	for _, ts := range items {
+		var (
+			buf  []byte
+			refs []byte
+			name string
+		)
+		for _, l := range ts.Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+			}
+			refs = protowire.AppendVarint(refs, uint64(st.ref(l.Name)))
+			refs = protowire.AppendVarint(refs, uint64(st.ref(l.Value)))
+		}
+		buf = protowire.AppendTag(buf, fieldSeriesLabelsRefs, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, refs)
+
+		for _, s := range ts.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, fieldSampleValue, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+			sb = protowire.AppendTag(sb, fieldSampleTimestamp, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+			buf = protowire.AppendTag(buf, fieldSeriesSamples, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, sb)
+		}
+
+		for i := range ts.Histograms {
+			hb, err := ts.Histograms[i].Marshal()
+			if err != nil {
+				return nil, err
+			}
+			buf = protowire.AppendTag(buf, fieldSeriesHistograms, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, hb)
+		}
+
+		if md != nil {
+			if fm, has := md.family(name); has {
+				var mb []byte
+				if t := metadataType(fm.Type); t != 0 {
+					mb = protowire.AppendTag(mb, fieldMetadataType, protowire.VarintType)
+					mb = protowire.AppendVarint(mb, t)
+				}
+				if fm.Help != "" {
+					mb = protowire.AppendTag(mb, fieldMetadataHelpRef, protowire.VarintType)
+					mb = protowire.AppendVarint(mb, uint64(st.ref(fm.Help)))
+				}
+				if fm.Unit != "" {
+					mb = protowire.AppendTag(mb, fieldMetadataUnitRef, protowire.VarintType)
+					mb = protowire.AppendVarint(mb, uint64(st.ref(fm.Unit)))
+				}
+				buf = protowire.AppendTag(buf, fieldSeriesMetadata, protowire.BytesType)
+				buf = protowire.AppendBytes(buf, mb)
+			}
+			if ct := md.createdTimestamp(ts.Labels); ct != 0 {
+				buf = protowire.AppendTag(buf, fieldSeriesCreatedTs, protowire.VarintType)
+				buf = protowire.AppendVarint(buf, uint64(ct))
+			}
+		}
+
+		series = append(series, buf)
+	}
+
+	var req []byte
+	for _, s := range st.symbols {
+		req = protowire.AppendTag(req, fieldRequestSymbols, protowire.BytesType)
+		req = protowire.AppendString(req, s)
+	}
+	for _, s := range series {
+		req = protowire.AppendTag(req, fieldRequestTimeseries, protowire.BytesType)
+		req = protowire.AppendBytes(req, s)
+	}
+	return req, nil
+}
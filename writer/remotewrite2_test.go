@@ -0,0 +1,107 @@
+package writer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"flashcat.cloud/categraf/types"
+)
+
+// field is one decoded protobuf field, value is the raw varint/fixed64 or the bytes
+type field struct {
+	num   protowire.Number
+	value uint64
+	bytes []byte
+}
+
+func decodeFields(t *testing.T, b []byte) []field {
+	var fields []field
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.Greater(t, n, 0)
+		b = b[n:]
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		require.Greater(t, n, 0)
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestEncodeRequestV2(t *testing.T) {
+	md := newMetadataStore()
+	labels := []prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}}
+	created := time.UnixMilli(1700000000000)
+	md.update(&types.Sample{Metric: "http_requests_total", Type: types.Counter, Help: "requests", Created: created},
+		&prompb.TimeSeries{Labels: labels})
+
+	data, err := encodeRequestV2([]prompb.TimeSeries{{
+		Labels:  labels,
+		Samples: []prompb.Sample{{Value: 42, Timestamp: 1700000001000}},
+	}}, md)
+	require.NoError(t, err)
+
+	var (
+		symbols []string
+		series  [][]byte
+	)
+	for _, f := range decodeFields(t, data) {
+		switch f.num {
+		case fieldRequestSymbols:
+			symbols = append(symbols, string(f.bytes))
+		case fieldRequestTimeseries:
+			series = append(series, f.bytes)
+		}
+	}
+	require.Equal(t, "", symbols[0])
+	require.Len(t, series, 1)
+
+	var gotLabels []string
+	for _, f := range decodeFields(t, series[0]) {
+		switch f.num {
+		case fieldSeriesLabelsRefs:
+			for b := f.bytes; len(b) > 0; {
+				ref, n := protowire.ConsumeVarint(b)
+				gotLabels = append(gotLabels, symbols[ref])
+				b = b[n:]
+			}
+		case fieldSeriesSamples:
+			sf := decodeFields(t, f.bytes)
+			require.Equal(t, 42.0, math.Float64frombits(sf[0].value))
+			require.EqualValues(t, 1700000001000, sf[1].value)
+		case fieldSeriesMetadata:
+			mf := decodeFields(t, f.bytes)
+			require.EqualValues(t, 1, mf[0].value)
+			require.Equal(t, "requests", symbols[mf[1].value])
+		case fieldSeriesCreatedTs:
+			require.EqualValues(t, created.UnixMilli(), f.value)
+		}
+	}
+	require.Equal(t, []string{"__name__", "http_requests_total", "code", "200"}, gotLabels)
+}
+
+func TestFloatSeries(t *testing.T) {
+	items := []prompb.TimeSeries{
+		{Samples: []prompb.Sample{{Value: 1}}},
+		{Histograms: []prompb.Histogram{{}}},
+		{Samples: []prompb.Sample{{Value: 2}}},
+	}
+	got := floatSeries(items)
+	require.Len(t, got, 2)
+	require.Equal(t, 2.0, got[1].Samples[0].Value)
+}
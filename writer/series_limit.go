@@ -0,0 +1,221 @@
+package writer
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+const seriesPurgePeriod = time.Minute
+
+type trackedSeries struct {
+	labels []prompb.Label
+	seen   time.Time
+}
+
+// seriesLimiter counts the unique series written by every input, new series beyond
+// the limit of an input or the global limit are dropped
+type seriesLimiter struct {
+	sync.Mutex
+
+	maxSeries int
+	perInput  int
+	limits    map[string]int
+	expire    time.Duration
+
+	inputs    map[string]map[uint64]*trackedSeries
+	total     int
+	dropped   map[string]uint64
+	lastPurge time.Time
+}
+
+var limiter *seriesLimiter
+
+// initSeriesLimiter enables the series limiter if any limit is configured in [writer_opt]
+func initSeriesLimiter() {
+	opt := config.Config.WriterOpt
+	if opt.MaxSeries <= 0 && opt.MaxSeriesPerInput <= 0 && len(opt.SeriesLimits) == 0 {
+		return
+	}
+	limiter = newSeriesLimiter(opt.MaxSeries, opt.MaxSeriesPerInput, opt.SeriesLimits, time.Duration(opt.SeriesExpire))
+}
+
+func newSeriesLimiter(maxSeries, perInput int, limits map[string]int, expire time.Duration) *seriesLimiter {
+	return &seriesLimiter{
+		maxSeries: maxSeries,
+		perInput:  perInput,
+		limits:    limits,
+		expire:    expire,
+		inputs:    make(map[string]map[uint64]*trackedSeries),
+		dropped:   make(map[string]uint64),
+		lastPurge: time.Now(),
+	}
+}
+
+func (sl *seriesLimiter) limitOf(input string) int {
+	if l, has := sl.limits[input]; has {
+		return l
+	}
+	return sl.perInput
+}
+
+// admit drops the new series of items exceeding the limits, known series always pass
+func (sl *seriesLimiter) admit(input string, items []*prompb.TimeSeries) []*prompb.TimeSeries {
+	sl.Lock()
+	defer sl.Unlock()
+
+	now := time.Now()
+	sl.purge(now)
+
+	series, has := sl.inputs[input]
+	if !has {
+		series = make(map[uint64]*trackedSeries)
+		sl.inputs[input] = series
+	}
+	limit := sl.limitOf(input)
+
+	ret := items[:0]
+	dropped := uint64(0)
+	for _, item := range items {
+		h := seriesHash(item.Labels)
+		if ts, has := series[h]; has {
+			ts.seen = now
+			ret = append(ret, item)
+			continue
+		}
+		if (limit > 0 && len(series) >= limit) || (sl.maxSeries > 0 && sl.total >= sl.maxSeries) {
+			dropped++
+			continue
+		}
+		series[h] = &trackedSeries{labels: item.Labels, seen: now}
+		sl.total++
+		ret = append(ret, item)
+	}
+
+	if dropped > 0 {
+		if sl.dropped[input] == 0 {
+			log.Printf("W! input %s exceeds series limit, %d series active, %d in total, new series are dropped",
+				input, len(series), sl.total)
+		}
+		sl.dropped[input] += dropped
+	}
+	return ret
+}
+
+func (sl *seriesLimiter) purge(now time.Time) {
+	if now.Sub(sl.lastPurge) < seriesPurgePeriod {
+		return
+	}
+	for _, series := range sl.inputs {
+		for h, ts := range series {
+			if now.Sub(ts.seen) > sl.expire {
+				delete(series, h)
+				sl.total--
+			}
+		}
+	}
+	sl.lastPurge = now
+}
+
+func (sl *seriesLimiter) droppedTotal() map[string]uint64 {
+	sl.Lock()
+	defer sl.Unlock()
+	ret := make(map[string]uint64, len(sl.dropped))
+	for k, v := range sl.dropped {
+		ret[k] = v
+	}
+	return ret
+}
+
+// NameCount is a metric name or label key with the number of series or values it has
+type NameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// InputCardinality is the cardinality report of one input
+type InputCardinality struct {
+	Input   string      `json:"input"`
+	Series  int         `json:"series"`
+	Limit   int         `json:"limit"`
+	Dropped uint64      `json:"dropped"`
+	Metrics []NameCount `json:"metrics"`
+	Labels  []NameCount `json:"labels"`
+}
+
+// Cardinality reports the active series of the inputs accepted by match, with at most
+// top metric names by series and label keys by distinct values. ok is false if no
+// series limit is configured.
+func Cardinality(match func(input string) bool, top int) (ret []InputCardinality, ok bool) {
+	if limiter == nil {
+		return nil, false
+	}
+	return limiter.cardinality(match, top), true
+}
+
+func (sl *seriesLimiter) cardinality(match func(input string) bool, top int) []InputCardinality {
+	sl.Lock()
+	defer sl.Unlock()
+
+	ret := make([]InputCardinality, 0, len(sl.inputs))
+	for input, series := range sl.inputs {
+		if match != nil && !match(input) {
+			continue
+		}
+		metrics := make(map[string]int)
+		values := make(map[string]map[string]struct{})
+		for _, ts := range series {
+			for _, l := range ts.labels {
+				if l.Name == "__name__" {
+					metrics[l.Value]++
+					continue
+				}
+				vs, has := values[l.Name]
+				if !has {
+					vs = make(map[string]struct{})
+					values[l.Name] = vs
+				}
+				vs[l.Value] = struct{}{}
+			}
+		}
+		labels := make(map[string]int, len(values))
+		for k, vs := range values {
+			labels[k] = len(vs)
+		}
+
+		ret = append(ret, InputCardinality{
+			Input:   input,
+			Series:  len(series),
+			Limit:   sl.limitOf(input),
+			Dropped: sl.dropped[input],
+			Metrics: topN(metrics, top),
+			Labels:  topN(labels, top),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Series > ret[j].Series
+	})
+	return ret
+}
+
+func topN(m map[string]int, n int) []NameCount {
+	ret := make([]NameCount, 0, len(m))
+	for k, v := range m {
+		ret = append(ret, NameCount{Name: k, Count: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count == ret[j].Count {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].Count > ret[j].Count
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
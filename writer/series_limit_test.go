@@ -0,0 +1,43 @@
+package writer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func limitSeries(names ...string) []*prompb.TimeSeries {
+	ret := make([]*prompb.TimeSeries, 0, len(names))
+	for i, name := range names {
+		ret = append(ret, &prompb.TimeSeries{
+			Labels: []prompb.Label{{Name: "__name__", Value: name}, {Name: "id", Value: fmt.Sprint(i)}},
+		})
+	}
+	return ret
+}
+
+func TestSeriesLimiter(t *testing.T) {
+	sl := newSeriesLimiter(5, 3, map[string]int{"big": 10}, time.Hour)
+
+	got := sl.admit("small", limitSeries("a", "a", "b", "c"))
+	require.Len(t, got, 3)
+	// known series still pass
+	require.Len(t, sl.admit("small", limitSeries("a", "a")), 2)
+
+	// the global limit is reached before the limit of big
+	got = sl.admit("big", limitSeries("x", "x", "x", "x"))
+	require.Len(t, got, 2)
+
+	dropped := sl.droppedTotal()
+	require.EqualValues(t, 1, dropped["small"])
+	require.EqualValues(t, 2, dropped["big"])
+
+	report := sl.cardinality(nil, 1)
+	require.Len(t, report, 2)
+	require.Equal(t, "small", report[0].Input)
+	require.Equal(t, []NameCount{{Name: "id", Count: 3}}, report[0].Labels)
+	require.Equal(t, []NameCount{{Name: "a", Count: 2}}, report[0].Metrics)
+}
@@ -1,115 +1,357 @@
 package writer
 
 import (
-	"bytes"
-	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
-	"net"
 	"net/http"
-	"strings"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/snappy"
-	"github.com/prometheus/client_golang/api"
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/backoff"
+	"flashcat.cloud/categraf/pkg/diskqueue"
+	"flashcat.cloud/categraf/types"
 )
 
-type Writer struct {
-	Opts   config.WriterOption
-	Client api.Client
+// Writer sends one batch of series to a backend. A returned error makes the
+// batch retried, unless it is a PermanentError or a 4xx response
+type Writer interface {
+	Write(items []prompb.TimeSeries) error
 }
 
-// newWriter creates a new Writer from config.WriterOption
-func newWriter(opt config.WriterOption) (Writer, error) {
-	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
-		}).DialContext,
-		ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
-		MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
+type Creator func(opt config.WriterOption) (Writer, error)
+
+var WriterCreators = map[string]Creator{}
+
+// Add registers a writer type, it is referred by `type` of [[writers]]
+func Add(typ string, creator Creator) {
+	WriterCreators[typ] = creator
+}
+
+// PermanentError marks a batch the backend will never accept, it is dropped instead of retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// statusError is returned by http based writers when the endpoint answers with an error status
+type statusError struct {
+	code       int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("push data got status code: %v, response body: %s", e.code, e.body)
+}
+
+// retryable reports whether a failed write may succeed when it is sent again,
+// only 4xx responses except 429 mean the payload itself is rejected
+func retryable(err error) bool {
+	var pe *PermanentError
+	if errors.As(err, &pe) {
+		return false
 	}
-	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
-		opt.UseTLS = true
-		tlsConfig, err := opt.TLSConfig()
-		if err != nil {
-			return Writer{}, err
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= 500
+	}
+	return true
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay seconds and http date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
 		}
-		tr.TLSClientConfig = tlsConfig
 	}
-	cli, err := api.NewClient(api.Config{
-		Address:      opt.Url,
-		RoundTripper: tr,
-	})
+	return 0
+}
+
+// sender delivers batches to one Writer, it owns its queue and sender
+// goroutines so a slow or dead backend does not hold back the others
+type sender struct {
+	name   string
+	opt    config.WriterOption
+	writer Writer
+
+	queue  *types.SafeListLimited[[]prompb.TimeSeries]
+	policy backoff.Policy
+
+	// buffer holds batches that could not be delivered, nil if disk buffer is disabled
+	buffer *diskqueue.Queue
 
+	stats WriterStats
+}
+
+// WriterStats counts series delivered by one writer
+type WriterStats struct {
+	Name string `json:"name"`
+
+	SuccessTotal uint64 `json:"success_total"`
+	FailTotal    uint64 `json:"fail_total"`
+	DropTotal    uint64 `json:"drop_total"`
+	RetryCount   uint64 `json:"retry_count"`
+
+	QueueSize uint64 `json:"queue_size"`
+}
+
+// newSender creates the Writer of opt.Type and wraps it with a queue
+func newSender(opt config.WriterOption) (*sender, error) {
+	typ := opt.Type
+	if typ == "" {
+		typ = "prometheus"
+	}
+	creator, has := WriterCreators[typ]
+	if !has {
+		return nil, fmt.Errorf("writer type %s not supported", typ)
+	}
+	w, err := creator(opt)
 	if err != nil {
-		return Writer{}, err
+		return nil, fmt.Errorf("failed to create %s writer: %v", typ, err)
+	}
+
+	s := &sender{
+		name:   opt.Name(),
+		opt:    opt,
+		writer: w,
+		queue:  types.NewSafeListLimited[[]prompb.TimeSeries](opt.QueueSize),
+		policy: backoff.NewPolicy(2, float64(opt.RetryBackoffBase)/1000, float64(opt.RetryBackoffMax)/1000, 2, false),
 	}
+	s.stats.Name = s.name
 
-	return Writer{
-		Opts:   opt,
-		Client: cli,
-	}, nil
+	if db := config.Config.WriterOpt.DiskBuffer; db != nil && db.Enable {
+		h := fnv.New64a()
+		h.Write([]byte(s.name))
+		s.buffer, err = diskqueue.Open(diskqueue.Options{
+			Dir:          filepath.Join(db.Path, fmt.Sprintf("%x", h.Sum64())),
+			MaxBytes:     db.MaxBytes,
+			MaxAge:       time.Duration(db.MaxAge),
+			SegmentBytes: db.SegmentBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if n := s.buffer.Len(); n > 0 {
+			log.Printf("I! writer %s: %d batches buffered on disk will be replayed", s.name, n)
+		}
+	}
+
+	return s, nil
 }
 
-func (w Writer) Write(items []prompb.TimeSeries) {
+// start runs the sender goroutines and the disk buffer replayer
+func (s *sender) start() {
+	for i := 0; i < s.opt.Concurrency; i++ {
+		go s.loopSend()
+	}
+	if s.buffer != nil {
+		go s.replay()
+	}
+}
+
+// enqueue hands a batch to this writer without waiting for delivery
+func (s *sender) enqueue(items []prompb.TimeSeries) {
 	if len(items) == 0 {
 		return
 	}
+	if s.queue.PushFront(items) {
+		return
+	}
 
-	req := &prompb.WriteRequest{
-		Timeseries: items,
+	if s.buffer != nil {
+		if data, err := encodeRequest(items); err == nil {
+			s.spill(data)
+			return
+		}
 	}
+	atomic.AddUint64(&s.stats.FailTotal, uint64(len(items)))
+	log.Printf("E! writer %s: queue is full(%d batches), drop %d series", s.name, s.queue.Len(), len(items))
+}
 
-	data, err := proto.Marshal(req)
-	if err != nil {
-		log.Println("W! marshal prom data to proto got error:", err, "data:", items)
+func (s *sender) loopSend() {
+	for {
+		batch := s.queue.PopBack()
+		if batch == nil {
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+		s.send(*batch)
+	}
+}
+
+// send writes items to the backend, retrying with backoff on retryable errors
+func (s *sender) send(items []prompb.TimeSeries) {
+	if len(items) == 0 {
+		return
+	}
+
+	// keep batches in order while the backlog on disk is being replayed
+	if s.buffer != nil && s.buffer.Len() > 0 {
+		s.spillItems(items)
 		return
 	}
 
-	if err := w.post(snappy.Encode(nil, data)); err != nil {
-		log.Println("W! post to", w.Opts.Url, "got error:", err)
-		log.Println("W! example timeseries:", items[0].String())
+	count := uint64(len(items))
+	for attempt := 0; ; attempt++ {
+		err := s.writer.Write(items)
+		if err == nil {
+			atomic.AddUint64(&s.stats.SuccessTotal, count)
+			return
+		}
+
+		if !retryable(err) {
+			atomic.AddUint64(&s.stats.DropTotal, count)
+			log.Println("W! write to", s.name, "got error:", err)
+			log.Println("W! example timeseries:", items[0].String())
+			return
+		}
+
+		if s.opt.MaxRetries > 0 && attempt >= s.opt.MaxRetries {
+			log.Println("W! write to", s.name, "got error:", err, "retries:", attempt)
+			if s.buffer != nil {
+				s.spillItems(items)
+				return
+			}
+			atomic.AddUint64(&s.stats.FailTotal, count)
+			log.Println("W! example timeseries:", items[0].String())
+			return
+		}
+
+		atomic.AddUint64(&s.stats.RetryCount, 1)
+		wait := s.backoff(attempt+1, err)
+		if attempt == 0 {
+			log.Println("W! write to", s.name, "got error:", err, "retry after", wait)
+		} else if config.Config.DebugMode {
+			log.Println("D! write to", s.name, "got error:", err, "retry after", wait)
+		}
+		time.Sleep(wait)
 	}
 }
 
-func (w Writer) post(req []byte) error {
-	httpReq, err := http.NewRequest("POST", w.Opts.Url, bytes.NewReader(req))
-	if err != nil {
-		log.Println("W! create remote write request got error:", err)
-		return err
+// backoff returns how long to wait before the next attempt, Retry-After from the server takes precedence
+func (s *sender) backoff(numErrors int, err error) time.Duration {
+	var se *statusError
+	if errors.As(err, &se) && se.retryAfter > 0 {
+		return se.retryAfter
 	}
+	return s.policy.GetBackoffDuration(numErrors)
+}
 
-	httpReq.Header.Add("Content-Encoding", "snappy")
-	httpReq.Header.Set("Content-Type", "application/x-protobuf")
-	httpReq.Header.Set("User-Agent", "categraf")
-	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+// Stats returns a copy of the counters of this writer
+func (s *sender) Stats() WriterStats {
+	return WriterStats{
+		Name:         s.stats.Name,
+		SuccessTotal: atomic.LoadUint64(&s.stats.SuccessTotal),
+		FailTotal:    atomic.LoadUint64(&s.stats.FailTotal),
+		DropTotal:    atomic.LoadUint64(&s.stats.DropTotal),
+		RetryCount:   atomic.LoadUint64(&s.stats.RetryCount),
+		QueueSize:    uint64(s.queue.Len()),
+	}
+}
 
-	for i := 0; i < len(w.Opts.Headers); i += 2 {
-		httpReq.Header.Add(w.Opts.Headers[i], w.Opts.Headers[i+1])
-		if w.Opts.Headers[i] == "Host" {
-			httpReq.Host = w.Opts.Headers[i+1]
-		}
+// encodeRequest builds a snappy compressed remote write request, it is also the format stored in disk buffer
+func encodeRequest(items []prompb.TimeSeries) ([]byte, error) {
+	req := &prompb.WriteRequest{
+		Timeseries: items,
 	}
 
-	if w.Opts.BasicAuthUser != "" {
-		httpReq.SetBasicAuth(w.Opts.BasicAuthUser, w.Opts.BasicAuthPass)
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
 	}
+	return snappy.Encode(nil, data), nil
+}
 
-	resp, body, err := w.Client.Do(context.Background(), httpReq)
+func decodeRequest(data []byte) ([]prompb.TimeSeries, error) {
+	buf, err := snappy.Decode(nil, data)
 	if err != nil {
-		log.Println("W! push data with remote write request got error:", err, "response body:", string(body))
-		return err
+		return nil, err
+	}
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(buf, &req); err != nil {
+		return nil, err
 	}
+	return req.Timeseries, nil
+}
 
-	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("push data with remote write request got status code: %v, response body: %s", resp.StatusCode, string(body))
-		return err
+func (s *sender) spillItems(items []prompb.TimeSeries) {
+	data, err := encodeRequest(items)
+	if err != nil {
+		log.Println("E! writer", s.name, "failed to encode batch:", err)
+		return
 	}
+	s.spill(data)
+}
 
-	return nil
+func (s *sender) spill(data []byte) {
+	if err := s.buffer.Append(data); err != nil {
+		log.Println("E! writer", s.name, "failed to spill batch to disk:", err)
+	}
+}
+
+// replay sends buffered batches in order, a batch is removed only after the backend accepted it
+func (s *sender) replay() {
+	interval := time.Duration(config.Config.WriterOpt.DiskBuffer.ReplayInterval)
+	numErrors := 0
+	for {
+		data, err := s.buffer.Peek()
+		if err != nil {
+			if errors.Is(err, diskqueue.ErrClosed) {
+				return
+			}
+			log.Println("E! writer", s.name, "failed to read disk buffer:", err)
+			time.Sleep(interval)
+			continue
+		}
+		if data == nil {
+			time.Sleep(interval)
+			continue
+		}
+
+		items, err := decodeRequest(data)
+		if err == nil {
+			err = s.writer.Write(items)
+		} else {
+			err = &PermanentError{Err: err}
+		}
+		if err != nil {
+			if retryable(err) {
+				if config.Config.DebugMode {
+					log.Println("D! writer", s.name, "replay got error:", err)
+				}
+				numErrors = s.policy.IncError(numErrors)
+				time.Sleep(s.backoff(numErrors, err))
+				continue
+			}
+			log.Println("W! writer", s.name, "drop buffered batch:", err)
+		}
+		numErrors = s.policy.DecError(numErrors)
+
+		if err := s.buffer.Commit(); err != nil {
+			log.Println("E! writer", s.name, "failed to commit disk buffer:", err)
+		}
+	}
 }
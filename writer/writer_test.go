@@ -0,0 +1,169 @@
+package writer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func testSender(t *testing.T, handler http.HandlerFunc, maxRetries int) *sender {
+	config.Config = &config.ConfigType{}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	s, err := newSender(config.WriterOption{
+		Url:              srv.URL,
+		QueueSize:        10,
+		Concurrency:      1,
+		MaxRetries:       maxRetries,
+		RetryBackoffBase: 1,
+		RetryBackoffMax:  10,
+	})
+	require.NoError(t, err)
+	return s
+}
+
+func testSeries() []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+	}}
+}
+
+func TestWriteRetriesServerErrors(t *testing.T) {
+	var calls int32
+	s := testSender(t, func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}, 0)
+
+	s.send(testSeries())
+	st := s.Stats()
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	require.EqualValues(t, 1, st.SuccessTotal)
+	require.EqualValues(t, 2, st.RetryCount)
+}
+
+func TestWriteDropsClientErrors(t *testing.T) {
+	var calls int32
+	s := testSender(t, func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		rw.WriteHeader(http.StatusBadRequest)
+	}, 0)
+
+	s.send(testSeries())
+	st := s.Stats()
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	require.EqualValues(t, 1, st.DropTotal)
+	require.EqualValues(t, 0, st.RetryCount)
+}
+
+func TestWriteGivesUpAfterMaxRetries(t *testing.T) {
+	s := testSender(t, func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Retry-After", "0")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}, 2)
+
+	s.send(testSeries())
+	st := s.Stats()
+	require.EqualValues(t, 1, st.FailTotal)
+	require.EqualValues(t, 2, st.RetryCount)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	require.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	require.Equal(t, time.Duration(0), parseRetryAfter(""))
+	d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	require.True(t, d > 50*time.Second && d <= time.Minute)
+}
+
+func TestEncodeInflux(t *testing.T) {
+	items := []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "cpu_usage_idle"},
+			{Name: "ident", Value: "host 1"},
+			{Name: "cpu", Value: "cpu-total"},
+			{Name: "empty", Value: ""},
+		},
+		Samples: []prompb.Sample{{Value: 99.5, Timestamp: 1700000000000}},
+	}}
+	require.Equal(t, "cpu_usage_idle,cpu=cpu-total,ident=host\\ 1 value=99.5 1700000000000000000\n", string(encodeInflux(items)))
+}
+
+func TestPushTimeSeriesBackpressure(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	writers = &Writers{
+		writerMap:    map[string]*sender{},
+		queue:        types.NewSafeListLimited[*prompb.TimeSeries](2),
+		pushTotal:    make(map[string]uint64),
+		pushRejected: make(map[string]uint64),
+	}
+
+	require.NoError(t, PushTimeSeries("remotewrite", append(testSeries(), testSeries()...)))
+	// without disk buffer the pushes beyond the queue are rejected, not dropped
+	require.ErrorIs(t, PushTimeSeries("opentsdb", testSeries()), ErrQueueFull)
+	require.Equal(t, 2, writers.queue.Len())
+
+	ss := QueueMetrics()
+	require.Equal(t, map[string]uint64{"remotewrite": 2}, ss.PushTotal)
+	require.Equal(t, map[string]uint64{"opentsdb": 1}, ss.PushRejected)
+}
+
+func TestKafkaConfigSASL(t *testing.T) {
+	opt := config.WriterOption{SaslEnable: true, SaslUser: "u", SaslPassword: "p"}
+	for _, mechanism := range []string{"", "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"} {
+		opt.SaslMechanism = mechanism
+		c, err := kafkaConfig(opt)
+		require.NoError(t, err, mechanism)
+		require.NoError(t, c.Validate(), mechanism)
+	}
+
+	opt.SaslMechanism = "GSSAPI"
+	_, err := kafkaConfig(opt)
+	require.Error(t, err)
+}
+
+func TestKafkaWriterBrokersDown(t *testing.T) {
+	w, err := newKafkaWriter(config.WriterOption{Brokers: []string{"127.0.0.1:1"}, Topic: "metrics", DialTimeout: 100})
+	require.NoError(t, err)
+	w.(*KafkaWriter).config.Metadata.Retry.Max = 0
+
+	err = w.Write(testSeries())
+	require.Error(t, err)
+	require.True(t, retryable(err))
+}
+
+func TestSpillAllCountsWritersWithoutBuffer(t *testing.T) {
+	config.Config = &config.ConfigType{}
+	plain, err := newSender(config.WriterOption{Url: "http://127.0.0.1:1/write", QueueSize: 1})
+	require.NoError(t, err)
+
+	config.Config.WriterOpt.DiskBuffer = &config.DiskBuffer{Enable: true, Path: t.TempDir()}
+	buffered, err := newSender(config.WriterOption{Url: "http://127.0.0.1:2/write", QueueSize: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { buffered.buffer.Close() })
+
+	writers = &Writers{
+		writerMap:    map[string]*sender{plain.name: plain, buffered.name: buffered},
+		queue:        types.NewSafeListLimited[*prompb.TimeSeries](1),
+		pushTotal:    make(map[string]uint64),
+		pushRejected: make(map[string]uint64),
+	}
+
+	series := append(testSeries(), testSeries()...)
+	require.True(t, spillAll([]*prompb.TimeSeries{&series[0], &series[1]}))
+	require.EqualValues(t, 1, buffered.buffer.Len())
+	require.EqualValues(t, 2, plain.Stats().FailTotal)
+	require.EqualValues(t, 0, buffered.Stats().FailTotal)
+}
@@ -1,11 +1,14 @@
 package writer
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/prometheus/prompb"
@@ -17,51 +20,98 @@ import (
 // Writers manage all writers and metric queue
 type (
 	Writers struct {
-		writerMap map[string]Writer
+		writerMap map[string]*sender
 		queue     *types.SafeListLimited[*prompb.TimeSeries]
 		sync.Mutex
 
+		// series pushed to the http api by route
+		pushTotal    map[string]uint64
+		pushRejected map[string]uint64
+
 		Snapshot
 	}
 
 	Snapshot struct {
-		FailCount  uint64
-		FailTotal  uint64
-		TotalCount uint64
+		FailCount  uint64 `json:"fail_count"`
+		FailTotal  uint64 `json:"fail_total"`
+		TotalCount uint64 `json:"total_count"`
+
+		QueueSize uint64 `json:"queue_size"`
+
+		// disk buffer, summed over all writers
+		DiskQueueSize   uint64 `json:"disk_queue_size"`
+		DiskQueueBytes  uint64 `json:"disk_queue_bytes"`
+		DiskSpillTotal  uint64 `json:"disk_spill_total"`
+		DiskReplayTotal uint64 `json:"disk_replay_total"`
+		DiskDropTotal   uint64 `json:"disk_drop_total"`
+
+		Writers []WriterStats `json:"writers"`
+
+		// series dropped by series limits, by input
+		SeriesDropped map[string]uint64 `json:"series_dropped,omitempty"`
 
-		QueueSize uint64
+		// series pushed to the http api by route, and those rejected as the queue was full
+		PushTotal    map[string]uint64 `json:"push_total,omitempty"`
+		PushRejected map[string]uint64 `json:"push_rejected,omitempty"`
 	}
 )
 
+// ErrQueueFull is returned to pushes the queue can take neither in memory nor on disk
+var ErrQueueFull = errors.New("writer queue is full")
+
 var writers *Writers
 
+// metadata is kept only when some writer speaks remote write 2.0
+var metadata *metadataStore
+
 func InitWriters() error {
-	writerMap := map[string]Writer{}
+	writerMap := map[string]*sender{}
 	opts := config.Config.Writers
 	for _, opt := range opts {
-		writer, err := newWriter(opt)
+		s, err := newSender(opt)
 		if err != nil {
 			return err
 		}
-		writerMap[opt.Url] = writer
+		writerMap[s.name] = s
+		if opt.RemoteWriteVersion == remoteWriteV2 && metadata == nil {
+			metadata = newMetadataStore()
+		}
 	}
 
 	writers = &Writers{
-		writerMap: writerMap,
-		queue:     types.NewSafeListLimited[*prompb.TimeSeries](config.Config.WriterOpt.ChanSize),
+		writerMap:    writerMap,
+		queue:        types.NewSafeListLimited[*prompb.TimeSeries](config.Config.WriterOpt.ChanSize),
+		pushTotal:    make(map[string]uint64),
+		pushRejected: make(map[string]uint64),
+	}
+
+	for _, w := range writerMap {
+		w.start()
 	}
 
+	initExpose()
+	initSeriesLimiter()
+
 	go writers.LoopRead()
 	return nil
 }
 
 func (ws *Writers) LoopRead() {
+	idle := true
 	for {
+		if idle && ws.queue.Len() > 0 {
+			// spread the flushes of agents gathering at the same time
+			if jitter := time.Duration(config.Config.WriterOpt.FlushJitter); jitter > 0 {
+				time.Sleep(time.Duration(rand.Int63n(int64(jitter))))
+			}
+		}
 		series := ws.queue.PopBackN(config.Config.WriterOpt.Batch)
 		if len(series) == 0 {
+			idle = true
 			time.Sleep(time.Millisecond * 100)
 			continue
 		}
+		idle = false
 
 		items := make([]prompb.TimeSeries, len(series))
 		for i := 0; i < len(series); i++ {
@@ -74,6 +124,17 @@ func (ws *Writers) LoopRead() {
 
 // WriteSamples convert samples to []prompb.TimeSeries and batch write to queue
 func WriteSamples(samples []*types.Sample) {
+	WriteInputSamples("", samples)
+}
+
+// WriteInputSamples is WriteSamples for the samples of input, the series limits of input apply
+func WriteInputSamples(input string, samples []*types.Sample) {
+	WriteInputSamplesPrecision(input, "", samples)
+}
+
+// WriteInputSamplesPrecision is WriteInputSamples, timestamps are truncated to precision
+// instead of global.precision if it is not empty
+func WriteInputSamplesPrecision(input, precision string, samples []*types.Sample) {
 	if len(samples) == 0 {
 		return
 	}
@@ -85,59 +146,188 @@ func WriteSamples(samples []*types.Sample) {
 		printTestMetrics(samples)
 	}
 
+	items := toSeries(precision, samples)
+	if limiter != nil {
+		if items = limiter.admit(input, items); len(items) == 0 {
+			return
+		}
+	}
+	enqueue(items)
+}
+
+// PushSamples is WriteInputSamples for the samples pushed to route of the http api. Instead of
+// dropping them it returns ErrQueueFull when the queue is full, so that the client retries.
+func PushSamples(route string, samples []*types.Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if config.Config.TestMode {
+		printTestMetrics(samples)
+		return nil
+	}
+	if config.Config.DebugMode {
+		printTestMetrics(samples)
+	}
+	return pushSeries(route, toSeries("", samples))
+}
+
+// PushTimeSeries is PushSamples for the series of remote write, opentsdb and open-falcon
+func PushTimeSeries(route string, series []prompb.TimeSeries) error {
+	if len(series) == 0 {
+		return nil
+	}
+	items := make([]*prompb.TimeSeries, len(series))
+	for i := range series {
+		items[i] = &series[i]
+	}
+	return pushSeries(route, items)
+}
+
+func pushSeries(route string, items []*prompb.TimeSeries) error {
+	if limiter != nil {
+		if items = limiter.admit(route, items); len(items) == 0 {
+			return nil
+		}
+	}
+	success := enqueue(items)
+
+	writers.Lock()
+	defer writers.Unlock()
+	if !success {
+		writers.pushRejected[route] += uint64(len(items))
+		return ErrQueueFull
+	}
+	writers.pushTotal[route] += uint64(len(items))
+	return nil
+}
+
+// toSeries converts samples to series, timestamps are truncated to precision, or
+// global.precision if it is empty
+func toSeries(precision string, samples []*types.Sample) []*prompb.TimeSeries {
+	if precision == "" {
+		precision = config.Config.Global.Precision
+	}
 	items := make([]*prompb.TimeSeries, 0, len(samples))
 	for _, sample := range samples {
-		item := sample.ConvertTimeSeries(config.Config.Global.Precision)
+		item := sample.ConvertTimeSeries(precision)
 		if item == nil || len(item.Labels) == 0 {
 			continue
 		}
+		if metadata != nil {
+			metadata.update(sample, item)
+		}
 		items = append(items, item)
 	}
+	return items
+}
+
+// enqueue pushes items to the queue, or spills them to disk if it is full. It returns false
+// if items are dropped.
+func enqueue(items []*prompb.TimeSeries) bool {
+	if len(items) == 0 {
+		return true
+	}
 	success := writers.queue.PushFrontN(items)
 	l := writers.queue.Len()
 	if !success {
-		log.Printf("E! write %d samples failed, please increase queue size(%d)", len(items), l)
+		if spillAll(items) {
+			success = true
+		} else {
+			log.Printf("E! write %d samples failed, please increase queue size(%d)", len(items), l)
+		}
 	}
-	go snapshot(uint64(len(items)), uint64(l), success)
+	go writers.snapshot(uint64(len(items)), uint64(l), success)
+	return success
 }
 
-func snapshot(count, size uint64, success bool) {
-	writers.Lock()
-	defer writers.Unlock()
-	writers.TotalCount += count
-	writers.QueueSize = size
+// spillAll writes the overflowed series to the disk buffer of every writer, writers
+// without disk buffer count them as failed. It returns false if no writer kept them.
+func spillAll(items []*prompb.TimeSeries) bool {
+	buffered := false
+	for _, w := range writers.writerMap {
+		buffered = buffered || w.buffer != nil
+	}
+	if !buffered {
+		return false
+	}
+
+	series := make([]prompb.TimeSeries, len(items))
+	for i := range items {
+		series[i] = *items[i]
+	}
+	data, err := encodeRequest(series)
+	if err != nil {
+		return false
+	}
+
+	for _, w := range writers.writerMap {
+		if w.buffer == nil {
+			atomic.AddUint64(&w.stats.FailTotal, uint64(len(items)))
+			log.Printf("E! writer %s: queue is full and disk buffer is disabled, drop %d series", w.name, len(items))
+			continue
+		}
+		w.spill(data)
+	}
+	return true
+}
+
+func (ws *Writers) snapshot(count, size uint64, success bool) {
+	ws.Lock()
+	defer ws.Unlock()
+	ws.TotalCount += count
+	ws.QueueSize = size
 	if !success {
-		writers.FailCount++
-		writers.FailTotal += count
+		ws.FailCount++
+		ws.FailTotal += count
 	}
 }
 
 func QueueMetrics() *Snapshot {
+	if writers == nil {
+		// writers are not started in --once and --check-config
+		return &Snapshot{}
+	}
 	writers.Lock()
 	defer writers.Unlock()
 	ss := writers.Snapshot
+	ss.PushTotal = make(map[string]uint64, len(writers.pushTotal))
+	for route, n := range writers.pushTotal {
+		ss.PushTotal[route] = n
+	}
+	ss.PushRejected = make(map[string]uint64, len(writers.pushRejected))
+	for route, n := range writers.pushRejected {
+		ss.PushRejected[route] = n
+	}
+	if limiter != nil {
+		ss.SeriesDropped = limiter.droppedTotal()
+	}
+	ss.Writers = make([]WriterStats, 0, len(writers.writerMap))
+	for _, w := range writers.writerMap {
+		ss.Writers = append(ss.Writers, w.Stats())
+		if w.buffer == nil {
+			continue
+		}
+		st := w.buffer.Stats()
+		ss.DiskQueueSize += uint64(st.Count)
+		ss.DiskQueueBytes += uint64(st.Bytes)
+		ss.DiskSpillTotal += st.Appended
+		ss.DiskReplayTotal += st.Committed
+		ss.DiskDropTotal += st.Dropped
+	}
 	return &ss
 }
 
-// WriteTimeSeries write prompb.TimeSeries to all writers
+// WriteTimeSeries hands prompb.TimeSeries to the queue of every writer
 func WriteTimeSeries(timeSeries []prompb.TimeSeries) {
 	if len(timeSeries) == 0 {
 		return
 	}
 
-	now := time.Now()
-	wg := sync.WaitGroup{}
 	for key := range writers.writerMap {
-		wg.Add(1)
-		go func(key string) {
-			defer wg.Done()
-			writers.writerMap[key].Write(timeSeries)
-		}(key)
+		writers.writerMap[key].enqueue(timeSeries)
 	}
-	wg.Wait()
 	if config.Config.DebugMode {
-		log.Println("D!, write", len(timeSeries), "time series to all writers, cost:",
-			time.Since(now).Milliseconds(), "ms")
+		log.Println("D!, enqueue", len(timeSeries), "time series to all writers")
 	}
 }
 